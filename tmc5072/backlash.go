@@ -0,0 +1,62 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for compensating backlash between
+// the motor and the load.
+package tmc5072
+
+// The load lags the motor by the backlash whenever the direction of travel reverses. Positions
+// reported to and requested by the caller are in load coordinates: after a move in the positive
+// direction the load and motor agree, after a move in the negative direction the load sits
+// backlash revolutions above the motor.
+
+// backlashOffset returns the load position minus the motor position, in revolutions.
+func (m *Motor) backlashOffset() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lastDirection < 0 {
+		return m.backlash
+	}
+	return 0
+}
+
+// setDirection records the direction of the move in progress, ignoring zero.
+func (m *Motor) setDirection(direction float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case direction > 0:
+		m.lastDirection = 1
+	case direction < 0:
+		m.lastDirection = -1
+	}
+}
+
+// offsetFor returns the backlash offset once the motor is moving in the given direction.
+func (m *Motor) offsetFor(direction float64) float64 {
+	if direction < 0 {
+		return m.backlash
+	}
+	return 0
+}
+
+// loadPosition converts a motor position in steps into the load position in revolutions.
+func (m *Motor) loadPosition(pos int64) float64 {
+	return m.stepsToRevs(pos) + m.backlashOffset()
+}
+
+// motorTarget converts a target in load coordinates into the motor target, in steps, of a move
+// starting from pos, and returns the direction of that move. When the move reverses direction the
+// motor travels the backlash further, taking up the slack before the load starts to move. The
+// direction is only passed to setDirection once the move has started, so a move that is refused
+// leaves the load position where it was.
+func (m *Motor) motorTarget(target float64, pos int64) (int64, float64) {
+	if m.backlash == 0 {
+		return m.revsToSteps(target), 0
+	}
+	direction := target - m.loadPosition(pos)
+	offset := m.backlashOffset()
+	if direction != 0 {
+		offset = m.offsetFor(direction)
+	}
+	return m.revsToSteps(target - offset), direction
+}
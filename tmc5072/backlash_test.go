@@ -0,0 +1,95 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestBacklash(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BacklashRevs = 0.1
+
+	t.Run("config validation", func(t *testing.T) {
+		cfg := mc
+		cfg.BacklashRevs = -0.1
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("reversals take up the slack", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		goToTx := func(target []byte) [][]byte {
+			return [][]byte{
+				{160, 0, 0, 0, 0},    // rampMode
+				{164, 0, 0, 21, 8},   // a1
+				{166, 0, 0, 21, 8},   // aMax
+				{170, 0, 0, 21, 8},   // d1
+				{168, 0, 0, 21, 8},   // dMax
+				{163, 0, 0, 0, 1},    // vStart
+				{171, 0, 0, 0, 10},   // vStop
+				{165, 0, 2, 17, 149}, // v1
+				{167, 0, 0, 211, 213},
+				append([]byte{173}, target...),
+			}
+		}
+
+		// Moving back from 4.0 to 3.2 revolutions reverses, so the motor goes on to 3.1
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 32, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx(goToTx([]byte{0, 2, 108, 0}))
+		test.That(t, m.GoTo(ctx, 50, 3.2, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+
+		// The load is reported where it was asked to go
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 2, 108, 0}},
+		)
+		pos, err := m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldAlmostEqual, 3.2)
+
+		// Moving forward again reverses once more, the motor lands on the target
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 2, 108, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx(goToTx([]byte{0, 3, 232, 0}))
+		test.That(t, m.GoTo(ctx, 50, 5.0, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 232, 0}},
+		)
+		pos, err = m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldAlmostEqual, 5.0)
+	})
+
+	t.Run("a refused move leaves the load where it was", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+		// Reversing from 4.0 revolutions by more than the chip can move at once writes nothing
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 32, 0}},
+		)
+		err := m.GoTo(ctx, 50, -50000, map[string]interface{}{"wait": false})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "longer than the chip can make")
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 32, 0}},
+		)
+		pos, err := m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldAlmostEqual, 4.0)
+	})
+}
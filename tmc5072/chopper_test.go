@@ -0,0 +1,111 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/test"
+)
+
+func TestChopper(t *testing.T) {
+	intp := func(v int) *int { return &v }
+
+	t.Run("defaults to spreadCycle as before", func(t *testing.T) {
+		test.That(t, (&Chopper{}).chopConfValue(), test.ShouldEqual, int32(0x000100C3))
+	})
+
+	t.Run("writes the configured fields", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.Chopper = Chopper{TOff: intp(5), HStrt: intp(2), HEnd: intp(0), TBL: intp(1), RndTf: true, Intpol: true}
+		setupTx := append([][]byte{{236, 16, 0, 160, 37}}, testMotorSetupTx[1:]...)
+		makeTestMotor(t, mc, setupTx)
+	})
+
+	t.Run("constant off time and vsense", func(t *testing.T) {
+		c := Chopper{HStrt: intp(7), HEnd: intp(15), CHM: true, VSense: true}
+		test.That(t, c.validate(), test.ShouldBeNil)
+		test.That(t, c.chopConfValue(), test.ShouldEqual, int32(0x000347F3))
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.Chopper = Chopper{TOff: intp(0)}
+		_, _, err := mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		mc.Chopper = Chopper{TBL: intp(4)}
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		// a hysteresis of 8 + 12 is too much for spreadCycle
+		mc.Chopper = Chopper{HStrt: intp(7), HEnd: intp(15)}
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "hysteresis")
+	})
+}
+
+func TestMicrosteps(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("programs MRES and converts in microsteps", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.Microsteps = 16
+		fakeSpiHandle, m := makeTestMotor(t, mc, [][]byte{
+			{236, 4, 1, 0, 195}, // MRES=4
+			{176, 0, 6, 15, 8},
+			{237, 0, 0, 0, 0},
+			{164, 0, 0, 1, 80},
+			{166, 0, 0, 1, 80},
+			{170, 0, 0, 1, 80},
+			{168, 0, 0, 1, 80},
+			{163, 0, 0, 0, 1},
+			{171, 0, 0, 0, 10},
+			{165, 0, 0, 33, 25},
+			{177, 0, 0, 6, 158},
+			{167, 0, 0, 0, 0},
+			{160, 0, 0, 0, 1},
+			{1, 0, 0, 0, 0},
+			{1, 0, 0, 0, 0},
+			{161, 0, 0, 0, 0},
+		})
+		test.That(t, m.stepsPerRev, test.ShouldEqual, 3200.0)
+
+		// One revolution is 3200 steps
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 12, 128}},
+		)
+		pos, err := m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldEqual, 1.0)
+	})
+
+	t.Run("refuses a max_rpm beyond VMAX", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.MaxRPM = 8000
+		_, fakeSpi := newFakeSpi(t)
+		_, err := makeMotor(ctx, nil, mc, resource.NewName(motor.API, "motor1"), logging.NewTestLogger(t), fakeSpi)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "configure fewer microsteps")
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		mc := testMotorConfig()
+		for _, microsteps := range []int{1, 8, 256} {
+			mc.Microsteps = microsteps
+			_, _, err := mc.Validate("")
+			test.That(t, err, test.ShouldBeNil)
+		}
+		for _, microsteps := range []int{-1, 3, 512} {
+			mc.Microsteps = microsteps
+			_, _, err := mc.Validate("")
+			test.That(t, err, test.ShouldNotBeNil)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for CoolStep, which scales the motor
+// current with the load measured by StallGuard.
+package tmc5072
+
+import (
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+// COOLCONF field positions.
+const (
+	coolConfSEUpShift  = 5
+	coolConfSEMaxShift = 8
+	coolConfSEDnShift  = 13
+	coolConfSEIMin     = 1 << 15
+)
+
+// CoolStep configures the CoolStep current regulation. The current is raised when SG_RESULT falls
+// below SEMIN*32 and lowered again above (SEMIN+SEMAX+1)*32. It is only active above VCOOLTHRS,
+// see vcoolthrs_rpm, and like StallGuard needs spreadCycle.
+type CoolStep struct {
+	SEMin  int  `json:"semin"`            // 1-15, the lower SG_RESULT threshold in units of 32
+	SEMax  int  `json:"semax,omitempty"`  // 0-15, the width of the hysteresis above it in units of 32
+	SEUp   int  `json:"seup,omitempty"`   // 0-3, a current increment of 1, 2, 4 or 8 steps
+	SEDn   int  `json:"sedn,omitempty"`   // 0-3, a decrement every 32, 8, 2 or 1 readings
+	SEIMin bool `json:"seimin,omitempty"` // go down to 1/4 of the run current instead of 1/2
+}
+
+// validate checks the CoolStep settings against the COOLCONF field sizes.
+func (cs *CoolStep) validate() error {
+	if cs == nil {
+		return nil
+	}
+	checkRange := func(name string, val, vMin, vMax int) error {
+		if val < vMin || val > vMax {
+			return errors.Errorf("%s must be between %d and %d, got %d", name, vMin, vMax, val)
+		}
+		return nil
+	}
+	return multierr.Combine(
+		// SEMIN 0 turns CoolStep off
+		checkRange("semin", cs.SEMin, 1, 15),
+		checkRange("semax", cs.SEMax, 0, 15),
+		checkRange("seup", cs.SEUp, 0, 3),
+		checkRange("sedn", cs.SEDn, 0, 3),
+	)
+}
+
+// coolConfBits returns the COOLCONF bits of the CoolStep settings, which are zero when CoolStep is
+// not configured.
+func (cs *CoolStep) coolConfBits() int32 {
+	if cs == nil {
+		return 0
+	}
+	value := int32(cs.SEMin) | int32(cs.SEUp)<<coolConfSEUpShift | int32(cs.SEMax)<<coolConfSEMaxShift |
+		int32(cs.SEDn)<<coolConfSEDnShift
+	if cs.SEIMin {
+		value |= coolConfSEIMin
+	}
+	return value
+}
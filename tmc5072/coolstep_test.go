@@ -0,0 +1,71 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestCoolStep(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.CoolStep = &CoolStep{SEMin: 5, SEMax: 2, SEUp: 1, SEDn: 3, SEIMin: true}
+	mc.VCoolThrsRPM = 50
+
+	t.Run("configures COOLCONF and VCOOLTHRS, and reports CS_ACTUAL", func(t *testing.T) {
+		setupTx := append([][]byte{}, testMotorSetupTx...)
+		setupTx[2] = []byte{237, 0, 0, 226, 37}   // SEMIN=5, SEUP=1, SEMAX=2, SEDN=3, SEIMIN
+		setupTx[10] = []byte{177, 0, 0, 211, 213} // VCOOLTHRS at 50 rpm
+		fakeSpiHandle, m := makeTestMotor(t, mc, setupTx)
+
+		// COOLCONF keeps the CoolStep bits when the StallGuard threshold changes
+		test.That(t, m.coolConfValue(-3), test.ShouldEqual, int32(0x007DE225))
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 22, 1, 44}, // CS_ACTUAL 22
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 211, 213},
+			},
+		)
+		status, err := m.DoCommand(ctx, map[string]interface{}{"command": "move_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["cs_actual"], test.ShouldEqual, int32(22))
+		_, ok := status["load_pct"]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		cfg := mc
+		cfg.CoolStep = &CoolStep{SEMin: 0}
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		cfg.CoolStep = &CoolStep{SEMin: 1, SEUp: 4}
+		_, _, err = cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		cfg.CoolStep = nil
+		cfg.VCoolThrsRPM = -1
+		_, _, err = cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,264 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for moves that coordinate both
+// channels of one TMC5072 chip.
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.viam.com/rdk/components/motor"
+)
+
+// chipMotors tracks the motors configured on each chip, keyed by SPI bus and chip select, so that
+// one channel can find the other for coordinated moves.
+var (
+	chipMotorsMu sync.Mutex
+	chipMotors   = map[string]*[2]*Motor{}
+)
+
+func chipKey(spiBus, chipSelect string) string {
+	return spiBus + "/" + chipSelect
+}
+
+// registerOnChip records m as the motor driving its channel of the chip.
+func (m *Motor) registerOnChip() {
+	chipMotorsMu.Lock()
+	defer chipMotorsMu.Unlock()
+	channels, ok := chipMotors[m.chipKey]
+	if !ok {
+		channels = &[2]*Motor{}
+		chipMotors[m.chipKey] = channels
+	}
+	channels[m.index-1] = m
+}
+
+// unregisterFromChip removes m from the chip, unless another motor has since taken its channel.
+func (m *Motor) unregisterFromChip() {
+	chipMotorsMu.Lock()
+	defer chipMotorsMu.Unlock()
+	channels, ok := chipMotors[m.chipKey]
+	if !ok || channels[m.index-1] != m {
+		return
+	}
+	channels[m.index-1] = nil
+	if channels[0] == nil && channels[1] == nil {
+		delete(chipMotors, m.chipKey)
+	}
+}
+
+// partner returns the motor on the other channel of the same chip.
+func (m *Motor) partner() (*Motor, error) {
+	chipMotorsMu.Lock()
+	defer chipMotorsMu.Unlock()
+	if channels, ok := chipMotors[m.chipKey]; ok && channels[2-m.index] != nil {
+		return channels[2-m.index], nil
+	}
+	return nil, errors.Errorf("no motor configured on channel %d of the chip used by motor (%s)", 3-m.index, m.motorName)
+}
+
+// syncRampParameters returns the ramp parameters of two axes moving the given distances, in steps,
+// so that both follow the same ramp shape stretched to their distance and arrive together. Every
+// velocity and acceleration is the lowest per step of distance that either axis allows, so neither
+// axis runs beyond its own limits. An axis that doesn't move keeps its own parameters.
+func syncRampParameters(params [2]rampParameters, distances [2]int64) [2]rampParameters {
+	if distances[0] == 0 || distances[1] == 0 {
+		return params
+	}
+	fields := func(rp *rampParameters) []**uint32 {
+		return []**uint32{&rp.VStart, &rp.VStop, &rp.V1, &rp.A1, &rp.D1, &rp.VMax, &rp.AMax, &rp.DMax}
+	}
+	// the chip needs a non-zero vStop and accelerations
+	minVals := []uint32{0, 1, 0, 1, 1, 0, 1, 1}
+
+	synced := params
+	for f, minVal := range minVals {
+		perStep := math.Inf(1)
+		for i := range params {
+			perStep = math.Min(perStep, float64(**fields(&params[i])[f])/float64(distances[i]))
+		}
+		for i := range synced {
+			val := uint32(math.Round(perStep * float64(distances[i])))
+			if val < minVal {
+				val = minVal
+			}
+			*fields(&synced[i])[f] = &val
+		}
+	}
+	return synced
+}
+
+// coordinatedGoTo moves both channels of the chip to their targets (in revolutions, indexed by
+// channel) so they arrive at the same moment. Each axis is limited to rpm and to its own ramp, and
+// both have their speeds and accelerations scaled by their distance so the path is a straight line
+// in joint space. Both targets are written back to back while holding the chip lock. A limit switch
+// or stall on either axis stops both.
+func (m *Motor) coordinatedGoTo(ctx context.Context, rpm float64, positions [2]float64) error {
+	other, err := m.partner()
+	if err != nil {
+		return err
+	}
+	if _, err := motor.CheckSpeed(rpm, m.maxRPM); err != nil {
+		return err
+	}
+	for _, axis := range []*Motor{m, other} {
+		if err := axis.checkHomed(ctx); err != nil {
+			return err
+		}
+	}
+	axes := [2]*Motor{m, other}
+	if m.index == 2 {
+		axes = [2]*Motor{other, m}
+	}
+
+	// Claim both channels, so that the other one stops whatever it was doing and so that a command
+	// sent to it (such as Stop) interrupts this move. They are claimed in channel order, so two
+	// coordinated moves started from either channel at once can't each hold one and wait for the
+	// other.
+	claim := func(axis *Motor) (context.Context, func()) {
+		if axis == m {
+			return axis.opMgr.New(ctx)
+		}
+		return axis.opMgr.New(context.Background())
+	}
+	ctx1, done1 := claim(axes[0])
+	defer done1()
+	ctx2, done2 := claim(axes[1])
+	defer done2()
+	opCtxs := [2]context.Context{ctx1, ctx2}
+	ctx, otherCtx := opCtxs[m.index-1], opCtxs[2-m.index]
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopOnOther := context.AfterFunc(otherCtx, cancel)
+	defer stopOnOther()
+
+	// Neither axis starts while a limit switch is stopping it, see limitSwitchTripped
+	for _, axis := range axes {
+		axis.stopMu.Lock()
+	}
+	unlockStops := sync.OnceFunc(func() {
+		for _, axis := range axes {
+			axis.stopMu.Unlock()
+		}
+	})
+	defer unlockStops()
+
+	var targets, distances [2]int64
+	var directions [2]float64
+	var chipTargets [2]int32
+	for i, axis := range axes {
+		if positions[i], err = axis.checkLimits(ctx, positions[i]); err != nil {
+			return err
+		}
+		pos, err := axis.readPosition(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "error in coordinated move from motor (%s)", axis.motorName)
+		}
+		positions[i] = axis.modularTarget(axis.loadPosition(pos), positions[i], 0)
+		targets[i], directions[i] = axis.motorTarget(positions[i], pos)
+		if chipTargets[i], err = axis.chipTarget(targets[i], pos); err != nil {
+			return err
+		}
+		distances[i] = targets[i] - pos
+		if err := axis.checkLimitSwitch(ctx, float64(distances[i])); err != nil {
+			return err
+		}
+		if distances[i] < 0 {
+			distances[i] = -distances[i]
+		}
+	}
+
+	var rampParams [2]rampParameters
+	for i, axis := range axes {
+		rampParams[i] = axis.rampParams
+		vmax := uint32(axis.rpmToV(math.Abs(rpm)))
+		rampParams[i].VMax = &vmax
+	}
+	rampParams = syncRampParameters(rampParams, distances)
+
+	defer func() {
+		for _, axis := range axes {
+			if err := axis.stopWatchingStalls(context.WithoutCancel(ctx)); err != nil {
+				axis.logger.CError(ctx, err)
+			}
+		}
+	}()
+	for i, axis := range axes {
+		if err := axis.watchForStalls(ctx); err != nil {
+			return errors.Wrapf(err, "error in coordinated move from motor (%s)", axis.motorName)
+		}
+		axis.markMoving(ctx)
+		err := multierr.Combine(
+			axis.writeReg(ctx, rampMode, modePosition),
+			axis.applyRampParameters(ctx, rampParams[i]),
+			axis.writeReg(ctx, vMax, int32(*rampParams[i].VMax)),
+		)
+		if err != nil {
+			return errors.Wrapf(err, "error in coordinated move from motor (%s)", axis.motorName)
+		}
+	}
+
+	globalMu.Lock()
+	err = multierr.Combine(
+		axes[0].writeRegLocked(ctx, xTarget, chipTargets[0]),
+		axes[1].writeRegLocked(ctx, xTarget, chipTargets[1]),
+	)
+	globalMu.Unlock()
+	if err != nil {
+		return errors.Wrapf(err, "error in coordinated move from motor (%s)", m.motorName)
+	}
+	for i, axis := range axes {
+		axis.setDirection(directions[i])
+		axis.mu.Lock()
+		axis.target = targets[i]
+		axis.mu.Unlock()
+	}
+	unlockStops()
+
+	err = m.opMgr.WaitForSuccess(ctx, 10*time.Millisecond, func(ctx context.Context) (bool, error) {
+		// every axis is checked each time, so a stall or limit switch on one is seen right away
+		allReached := true
+		for _, axis := range axes {
+			reached, err := axis.positionReached(ctx)
+			if err != nil {
+				return false, err
+			}
+			allReached = allReached && reached
+		}
+		return allReached, nil
+	})
+	if err != nil {
+		// Whether the caller gave up on the move or one axis was stopped early, the other would
+		// otherwise carry on alone, so bring both to a controlled stop.
+		stopCtx := context.WithoutCancel(ctx)
+		for i, axis := range axes {
+			if _, stopErr := axis.decelerateToStop(stopCtx, rampParams[i]); stopErr != nil {
+				err = multierr.Combine(err, stopErr)
+			}
+		}
+		if ctx.Err() != nil {
+			return errors.Wrapf(err, "coordinated move from motor (%s) interrupted", m.motorName)
+		}
+	}
+	return err
+}
+
+// parseCoordinatedPositions reads the per-channel targets of a coordinated move.
+func parseCoordinatedPositions(positionsRaw interface{}) ([2]float64, error) {
+	var positions [2]float64
+	positionsList, ok := positionsRaw.([]interface{})
+	if !ok || len(positionsList) != 2 {
+		return positions, errors.Errorf("%s must be a list of two positions, one per channel", Positions)
+	}
+	for i, positionRaw := range positionsList {
+		if positions[i], ok = positionRaw.(float64); !ok {
+			return positions, errors.Errorf("%s must be floating point", Positions)
+		}
+	}
+	return positions, nil
+}
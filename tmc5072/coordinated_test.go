@@ -0,0 +1,363 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/board/genericlinux/buses"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/test"
+)
+
+func TestSyncRampParameters(t *testing.T) {
+	rp := initRampParameters(500, 500, baseClk, 200*uSteps)
+
+	// With the same limits the longer move keeps them and the shorter one is scaled down
+	synced := syncRampParameters([2]rampParameters{rp, rp}, [2]int64{102400, 51200})
+	test.That(t, synced[0], test.ShouldResemble, rp)
+	test.That(t, *synced[1].AMax, test.ShouldEqual, *rp.AMax/2)
+	test.That(t, *synced[1].DMax, test.ShouldEqual, *rp.DMax/2)
+	test.That(t, *synced[1].V1, test.ShouldEqual, 67787)
+	test.That(t, *synced[1].VStop, test.ShouldEqual, 5)
+
+	// An axis with lower limits holds back the other, even when it has the shorter move
+	slow := initRampParameters(500, 100, baseClk, 200*uSteps)
+	synced = syncRampParameters([2]rampParameters{rp, slow}, [2]int64{102400, 51200})
+	test.That(t, *synced[1].AMax, test.ShouldEqual, *slow.AMax)
+	test.That(t, *synced[0].AMax, test.ShouldEqual, 2**slow.AMax)
+	test.That(t, *synced[0].V1, test.ShouldEqual, *rp.V1)
+
+	// Accelerations and vStop never scale down to zero
+	synced = syncRampParameters([2]rampParameters{rp, rp}, [2]int64{1 << 30, 1})
+	test.That(t, *synced[1].AMax, test.ShouldEqual, 1)
+	test.That(t, *synced[1].VStop, test.ShouldEqual, 1)
+	test.That(t, *synced[1].VMax, test.ShouldEqual, 0)
+
+	// An axis that stays put keeps its own parameters
+	synced = syncRampParameters([2]rampParameters{rp, slow}, [2]int64{102400, 0})
+	test.That(t, synced[0], test.ShouldResemble, rp)
+	test.That(t, synced[1], test.ShouldResemble, slow)
+}
+
+func TestCoordinatedGoTo(t *testing.T) {
+	ctx := context.Background()
+	mc1 := testMotorConfig()
+	mc1.SPIBus = "coordinated"
+	channel2SetupTx := [][]byte{
+		{252, 0, 1, 0, 195},
+		{208, 0, 6, 15, 8},
+		{253, 0, 0, 0, 0},
+		{196, 0, 0, 21, 8},
+		{198, 0, 0, 21, 8},
+		{202, 0, 0, 21, 8},
+		{200, 0, 0, 21, 8},
+		{195, 0, 0, 0, 1},
+		{203, 0, 0, 0, 10},
+		{197, 0, 2, 17, 149},
+		{209, 0, 0, 105, 234},
+		{199, 0, 0, 0, 0},
+		{192, 0, 0, 0, 1},
+		{1, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0},
+		{193, 0, 0, 0, 0},
+	}
+
+	t.Run("needs a motor on the other channel", func(t *testing.T) {
+		_, m1 := makeTestMotor(t, mc1, testMotorSetupTx)
+		_, err := m1.DoCommand(ctx, map[string]interface{}{
+			"command":   "coordinated_go_to",
+			"rpm":       50.0,
+			"positions": []interface{}{2.0, 1.0},
+		})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "no motor configured on channel 2")
+	})
+
+	t.Run("both channels arrive together", func(t *testing.T) {
+		mc2 := mc1
+		mc2.Index = 2
+		fakeSpi1, m1 := makeTestMotor(t, mc1, testMotorSetupTx)
+		fakeSpi2, _ := makeTestMotor(t, mc2, channel2SetupTx)
+
+		// Channel 1 travels 2 revolutions and leads at full speed and acceleration
+		fakeSpi1.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		fakeSpi1.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+			{173, 0, 1, 144, 0},
+		})
+		fakeSpi1.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 2, 0}},
+		)
+
+		// Channel 2 travels 1 revolution, so it runs at half the speed and acceleration
+		fakeSpi2.AddExpectedRx(
+			[][]byte{{65, 0, 0, 0, 0}, {65, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		fakeSpi2.AddExpectedTx([][]byte{
+			{192, 0, 0, 0, 0},
+			{196, 0, 0, 10, 132}, // a1
+			{198, 0, 0, 10, 132}, // aMax
+			{202, 0, 0, 10, 132}, // d1
+			{200, 0, 0, 10, 132}, // dMax
+			{195, 0, 0, 0, 1},    // vStart
+			{203, 0, 0, 0, 5},    // vStop
+			{197, 0, 1, 8, 203},  // v1
+			{199, 0, 0, 105, 235},
+			{205, 0, 0, 200, 0},
+		})
+		fakeSpi2.AddExpectedRx(
+			[][]byte{{85, 0, 0, 0, 0}, {85, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 2, 0}},
+		)
+
+		_, err := m1.DoCommand(ctx, map[string]interface{}{
+			"command":   "coordinated_go_to",
+			"rpm":       50.0,
+			"positions": []interface{}{2.0, 1.0},
+		})
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("a stall on one channel stops both", func(t *testing.T) {
+		mc2 := mc1
+		mc2.Index = 2
+		mc2.StallDetection = true
+		fakeSpi1, m1 := makeTestMotor(t, mc1, testMotorSetupTx)
+		fakeSpi2, _ := makeTestMotor(t, mc2, channel2SetupTx)
+
+		fakeSpi1.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		fakeSpi1.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},
+			{166, 0, 0, 21, 8},
+			{170, 0, 0, 21, 8},
+			{168, 0, 0, 21, 8},
+			{163, 0, 0, 0, 1},
+			{171, 0, 0, 0, 10},
+			{165, 0, 2, 17, 149},
+			{167, 0, 0, 211, 213},
+			{173, 0, 1, 144, 0},
+		})
+		// Still on its way when channel 2 stalls, then brought to a stop at 1.0 revolutions
+		fakeSpi1.AddExpectedRx(
+			[][]byte{
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{166, 0, 0, 21, 8},
+				{164, 0, 0, 21, 8},
+				{163, 0, 0, 0, 0},
+				{167, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{173, 0, 0, 200, 0},
+				{164, 0, 0, 21, 8},
+				{166, 0, 0, 21, 8},
+				{170, 0, 0, 21, 8},
+				{168, 0, 0, 21, 8},
+				{163, 0, 0, 0, 1},
+				{171, 0, 0, 0, 10},
+				{165, 0, 2, 17, 149},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 0}, // vzero
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+
+		fakeSpi2.AddExpectedRx(
+			[][]byte{{65, 0, 0, 0, 0}, {65, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		fakeSpi2.AddExpectedTx([][]byte{
+			{212, 0, 0, 4, 0}, // sg_stop
+			{192, 0, 0, 0, 0},
+			{196, 0, 0, 10, 132},
+			{198, 0, 0, 10, 132},
+			{202, 0, 0, 10, 132},
+			{200, 0, 0, 10, 132},
+			{195, 0, 0, 0, 1},
+			{203, 0, 0, 0, 5},
+			{197, 0, 1, 8, 203},
+			{199, 0, 0, 105, 235},
+			{205, 0, 0, 200, 0},
+		})
+		// Stalls at 0.5 revolutions
+		fakeSpi2.AddExpectedRx(
+			[][]byte{
+				{66, 0, 0, 0, 0},
+				{66, 0, 0, 0, 0},
+				{64, 0, 0, 0, 0},
+				{64, 0, 0, 0, 0},
+				{192, 0, 0, 0, 3},
+				{85, 0, 0, 0, 0},
+				{85, 0, 0, 0, 0},
+				{65, 0, 0, 0, 0},
+				{65, 0, 0, 0, 0},
+				{199, 0, 0, 0, 0},
+				{205, 0, 0, 100, 0},
+				{212, 0, 0, 0, 0},
+				{192, 0, 0, 0, 0},
+				{198, 0, 0, 10, 132},
+				{196, 0, 0, 10, 132},
+				{195, 0, 0, 0, 0},
+				{199, 0, 0, 0, 0},
+				{85, 0, 0, 0, 0},
+				{85, 0, 0, 0, 0},
+				{65, 0, 0, 0, 0},
+				{65, 0, 0, 0, 0},
+				{205, 0, 0, 100, 0},
+				{196, 0, 0, 10, 132},
+				{198, 0, 0, 10, 132},
+				{202, 0, 0, 10, 132},
+				{200, 0, 0, 10, 132},
+				{195, 0, 0, 0, 1},
+				{203, 0, 0, 0, 5},
+				{197, 0, 1, 8, 203},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0}, // halted
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 64}, // event_stop_sg
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 100, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 0}, // vzero
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 100, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+
+		_, err := m1.DoCommand(ctx, map[string]interface{}{
+			"command":   "coordinated_go_to",
+			"rpm":       50.0,
+			"positions": []interface{}{2.0, 1.0},
+		})
+		var stallErr *StallError
+		test.That(t, errors.As(err, &stallErr), test.ShouldBeTrue)
+		test.That(t, stallErr.Position, test.ShouldEqual, 0.5)
+	})
+
+	t.Run("started from both channels at once", func(t *testing.T) {
+		mc := mc1
+		mc.SPIBus = "coordinated-both"
+		var motors [2]*Motor
+		for i := range motors {
+			mc.Index = i + 1
+			m, err := makeMotor(ctx, nil, mc, resource.NewName(motor.API, fmt.Sprintf("motor%d", i+1)),
+				logging.NewTestLogger(t), &inject.SPI{OpenHandleFunc: func() (buses.SPIHandle, error) {
+					return settledSpiHandle{}, nil
+				}})
+			test.That(t, err, test.ShouldBeNil)
+			motors[i] = m.(*Motor)
+			t.Cleanup(func() {
+				test.That(t, m.Close(context.Background()), test.ShouldBeNil)
+			})
+		}
+
+		// Each move claims both channels. Whichever is started last may interrupt the other, but
+		// neither may end up holding one channel while waiting for the other.
+		for round := 0; round < 20; round++ {
+			errs := make(chan error, 2)
+			for _, m := range motors {
+				go func() {
+					_, err := m.DoCommand(ctx, map[string]interface{}{
+						"command":   "coordinated_go_to",
+						"rpm":       50.0,
+						"positions": []interface{}{2.0, 1.0},
+					})
+					errs <- err
+				}()
+			}
+			succeeded := 0
+			for range motors {
+				select {
+				case err := <-errs:
+					if err == nil {
+						succeeded++
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatal("coordinated moves from both channels deadlocked")
+				}
+			}
+			test.That(t, succeeded, test.ShouldBeGreaterThanOrEqualTo, 1)
+		}
+	})
+}
+
+// settledSpiHandle is a chip whose motors are always at rest on their targets, for tests where the
+// order of the traffic is not known in advance.
+type settledSpiHandle struct{}
+
+func (settledSpiHandle) Xfer(ctx context.Context, baud uint, chipSelect string, mode uint, tx []byte) ([]byte, error) {
+	rx := make([]byte, len(tx))
+	if tx[0] == rampStat || tx[0] == rampStat+0x20 {
+		rx[3] = 0x06 // position reached, velocity zero
+	}
+	return rx, nil
+}
+
+func (settledSpiHandle) Close() error {
+	return nil
+}
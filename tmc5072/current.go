@@ -0,0 +1,116 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for setting the motor currents in
+// amps from the sense resistor value.
+package tmc5072
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxCurrentRMS is the most the TMC5072 drives per coil continuously, in amps RMS.
+	maxCurrentRMS = 1.1
+	// rSenseInternal is the resistance the sense path adds to rsense_ohms.
+	rSenseInternal = 0.02
+	// vFullScale and vFullScaleVSense are the sense resistor voltages at full scale current with
+	// VSENSE off and on.
+	vFullScale       = 0.32
+	vFullScaleVSense = 0.18
+)
+
+// fullScaleCurrent is the RMS current at CS=31 for the sense resistor and VSENSE setting.
+func fullScaleCurrent(rSense float64, vsense bool) float64 {
+	vfs := vFullScale
+	if vsense {
+		vfs = vFullScaleVSense
+	}
+	return vfs / (rSense + rSenseInternal) / math.Sqrt2
+}
+
+// validateCurrents checks the run_current_amps and hold_current_amps settings against the chip and
+// motor ratings and what the sense resistor can drive.
+func (config *Config) validateCurrents() error {
+	if config.RSenseOhms == 0 && config.RunCurrentAmps == 0 && config.HoldCurrentAmps == 0 {
+		if config.RatedCurrentAmps != 0 {
+			return errors.New("rated_current_amps needs rsense_ohms and run_current_amps")
+		}
+		return nil
+	}
+	if config.RSenseOhms <= 0 {
+		return errors.New("rsense_ohms must be positive to set the currents in amps")
+	}
+	if config.RunCurrentAmps <= 0 {
+		return errors.New("run_current_amps must be positive when rsense_ohms is set")
+	}
+	if config.HoldCurrentAmps < 0 {
+		return errors.New("hold_current_amps must not be negative")
+	}
+	if config.RatedCurrentAmps < 0 {
+		return errors.New("rated_current_amps must not be negative")
+	}
+	if config.RunCurrent != 0 || config.HoldCurrent != 0 {
+		return errors.New("run_current and hold_current can't be combined with run_current_amps")
+	}
+	if config.Chopper.VSense {
+		return errors.New("vsense in chopper is chosen from run_current_amps, leave it unset")
+	}
+	limit, limitName := maxCurrentRMS, "the TMC5072 limit"
+	if config.RatedCurrentAmps > 0 && config.RatedCurrentAmps < limit {
+		limit, limitName = config.RatedCurrentAmps, "rated_current_amps"
+	}
+	if config.RunCurrentAmps > limit {
+		return errors.Errorf("run_current_amps %.2fA exceeds %s of %.2fA", config.RunCurrentAmps, limitName, limit)
+	}
+	if config.HoldCurrentAmps > limit {
+		return errors.Errorf("hold_current_amps %.2fA exceeds %s of %.2fA", config.HoldCurrentAmps, limitName, limit)
+	}
+	if fullScale := fullScaleCurrent(config.RSenseOhms, false); config.RunCurrentAmps > fullScale {
+		return errors.Errorf("rsense_ohms %.3f drives at most %.2fA, less than run_current_amps %.2fA",
+			config.RSenseOhms, fullScale, config.RunCurrentAmps)
+	}
+	// CS=0 is the smallest current the chip drives, anything less can't be honoured
+	fullScale, _ := config.currentFullScale()
+	step := fullScale / 32
+	if currentSteps(config.RunCurrentAmps, fullScale) < 1 {
+		return errors.Errorf("run_current_amps %.3fA is below the smallest step of %.3fA with rsense_ohms %.3f",
+			config.RunCurrentAmps, step, config.RSenseOhms)
+	}
+	if config.HoldCurrentAmps > 0 && currentSteps(config.HoldCurrentAmps, fullScale) < 1 {
+		return errors.Errorf("hold_current_amps %.3fA is below the smallest step of %.3fA with rsense_ohms %.3f",
+			config.HoldCurrentAmps, step, config.RSenseOhms)
+	}
+	return nil
+}
+
+// currentFullScale returns the full scale current and the VSENSE setting for run_current_amps.
+// VSENSE is on whenever the run current fits its lower full scale, which gives finer steps and
+// less heat in the sense resistor.
+func (config *Config) currentFullScale() (float64, bool) {
+	vsense := config.RunCurrentAmps <= fullScaleCurrent(config.RSenseOhms, true)
+	return fullScaleCurrent(config.RSenseOhms, vsense), vsense
+}
+
+// currentSteps returns how many 1/32 steps of fullScale fit in amps, rounded down.
+func currentSteps(amps, fullScale float64) int32 {
+	// I_RMS = (CS+1)/32 * full scale, with a little slack for floating point
+	return int32(math.Floor(amps/fullScale*32 + 1e-9))
+}
+
+// currentScales returns the IRUN and IHOLD values and the VSENSE setting for the currents in amps.
+// The scales round down, so the motor never gets more than asked; validateCurrents refuses
+// currents below the smallest step. hold_current_amps defaults to half the run current, raised to
+// the smallest step if need be.
+func (config *Config) currentScales() (int32, int32, bool) {
+	fullScale, vsense := config.currentFullScale()
+	scale := func(amps float64) int32 {
+		return min(max(currentSteps(amps, fullScale)-1, 0), 31)
+	}
+	hold := config.HoldCurrentAmps
+	if hold == 0 {
+		hold = config.RunCurrentAmps / 2
+	}
+	return scale(config.RunCurrentAmps), scale(hold), vsense
+}
@@ -0,0 +1,96 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestCurrentAmps(t *testing.T) {
+	t.Run("picks VSENSE when the run current fits its full scale", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.RSenseOhms = 0.15
+		mc.RunCurrentAmps = 0.5
+		setupTx := append([][]byte{}, testMotorSetupTx...)
+		setupTx[0] = []byte{236, 0, 3, 0, 195} // VSENSE
+		setupTx[1] = []byte{176, 0, 6, 20, 9}  // IRUN=20, IHOLD=9 for the default 0.25A
+		makeTestMotor(t, mc, setupTx)
+	})
+
+	t.Run("leaves VSENSE off for higher currents", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.RSenseOhms = 0.15
+		mc.RunCurrentAmps = 1.0
+		mc.HoldCurrentAmps = 0.3
+		run, hold, vsense := mc.currentScales()
+		test.That(t, vsense, test.ShouldBeFalse)
+		test.That(t, run, test.ShouldEqual, int32(23))
+		test.That(t, hold, test.ShouldEqual, int32(6))
+
+		// The scales never round up past the current asked for
+		test.That(t, float64(run+1)/32*fullScaleCurrent(0.15, false), test.ShouldBeLessThanOrEqualTo, 1.0)
+		test.That(t, float64(hold+1)/32*fullScaleCurrent(0.15, false), test.ShouldBeLessThanOrEqualTo, 0.3)
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		mc := testMotorConfig()
+		mc.RSenseOhms = 0.15
+		mc.RunCurrentAmps = 0.8
+		_, _, err := mc.Validate("")
+		test.That(t, err, test.ShouldBeNil)
+
+		// above the chip rating
+		mc.RunCurrentAmps = 1.2
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "TMC5072 limit")
+
+		// above the motor rating
+		mc.RunCurrentAmps = 0.8
+		mc.RatedCurrentAmps = 0.7
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "rated_current_amps")
+
+		// more than the sense resistor can drive
+		mc.RatedCurrentAmps = 0
+		mc.RSenseOhms = 0.33
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "drives at most")
+
+		mc.RSenseOhms = 0
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		mc.RSenseOhms = 0.15
+		mc.RunCurrent = 20
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		mc.RunCurrent = 0
+		mc.Chopper.VSense = true
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		// below the smallest step, 1/32 of the 0.75A full scale with VSENSE
+		mc.Chopper.VSense = false
+		mc.RunCurrentAmps = 0.02
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "smallest step")
+
+		mc.RunCurrentAmps = 0.8
+		mc.HoldCurrentAmps = 0.02
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "hold_current_amps")
+
+		// one step is enough
+		mc.HoldCurrentAmps = fullScaleCurrent(0.15, false) / 32
+		_, _, err = mc.Validate("")
+		test.That(t, err, test.ShouldBeNil)
+	})
+}
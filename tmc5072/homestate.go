@@ -0,0 +1,59 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for tracking whether the motor has
+// been homed.
+package tmc5072
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+// setHomed records whether the motor has been homed since it was configured.
+func (m *Motor) setHomed(homed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.homed = homed
+}
+
+// markHomed records a successful home. Any chip reset up to now is forgotten, so that only a later
+// one unhomes the motor.
+func (m *Motor) markHomed(ctx context.Context) error {
+	if _, err := m.chipWasReset(ctx); err != nil {
+		return errors.Wrapf(err, "error checking for a reset of motor (%s)", m.motorName)
+	}
+	m.setHomed(true)
+	return nil
+}
+
+// homeState reports whether the motor is homed. A homed motor whose chip has since been reset lost
+// its position with it, so it is unhomed.
+func (m *Motor) homeState(ctx context.Context) (bool, error) {
+	m.mu.Lock()
+	homed := m.homed
+	m.mu.Unlock()
+	if !homed {
+		return false, nil
+	}
+	reset, err := m.noticeReset(ctx)
+	if err != nil {
+		return false, err
+	}
+	return !reset, nil
+}
+
+// checkHomed refuses positioning moves until the motor is homed, if require_home_before_goto is set.
+func (m *Motor) checkHomed(ctx context.Context) error {
+	if !m.requireHome {
+		return nil
+	}
+	homed, err := m.homeState(ctx)
+	if err != nil {
+		return err
+	}
+	if !homed {
+		return errors.Errorf("motor (%s) must be homed before moving to a position, run the home command first", m.motorName)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestHomeState(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.SPIBus = "homestate"
+	mc.RequireHome = true
+
+	gstatRead := [][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}}
+	expectHomed := func(fakeSpiHandle *fakeSpiHandle, m *Motor) {
+		fakeSpiHandle.AddExpectedTx(gstatRead)
+		test.That(t, m.markHomed(ctx), test.ShouldBeNil)
+	}
+
+	t.Run("GoTo is refused until homed", func(t *testing.T) {
+		_, m := makeTestMotor(t, mc, testMotorSetupTx)
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "get_home_state"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["homed"], test.ShouldBeFalse)
+
+		err = m.GoTo(ctx, 50, 1, nil)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "must be homed")
+		test.That(t, m.GoFor(ctx, 50, 1, nil), test.ShouldNotBeNil)
+	})
+
+	t.Run("a chip reset unhomes the motor", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		expectHomed(fakeSpiHandle, m)
+
+		fakeSpiHandle.AddExpectedTx(gstatRead)
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "get_home_state"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["homed"], test.ShouldBeTrue)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {129, 0, 0, 0, 1}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 1}, {0, 0, 0, 0, 0}},
+		)
+		err = m.GoTo(ctx, 50, 1, nil)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "must be homed")
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceReset)
+	})
+
+	t.Run("ResetZeroPosition unhomes the motor", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		expectHomed(fakeSpiHandle, m)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 0, 0, 0, 0},
+			{161, 0, 0, 0, 0},
+		})
+		test.That(t, m.ResetZeroPosition(ctx, 0, nil), test.ShouldBeNil)
+		homed, err := m.homeState(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, homed, test.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,143 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for the software travel limits.
+package tmc5072
+
+import (
+	"context"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// travelLimits returns the software travel limits in revolutions, nil where unset.
+func (m *Motor) travelLimits() (*float64, *float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.minPosition, m.maxPosition
+}
+
+// checkLimits rejects a positioning target outside the software travel limits, or clamps it to
+// the nearest limit when clamp_to_limits is set.
+func (m *Motor) checkLimits(ctx context.Context, positionRevolutions float64) (float64, error) {
+	minPos, maxPos := m.travelLimits()
+	limit := positionRevolutions
+	switch {
+	case minPos != nil && positionRevolutions < *minPos:
+		limit = *minPos
+	case maxPos != nil && positionRevolutions > *maxPos:
+		limit = *maxPos
+	default:
+		return positionRevolutions, nil
+	}
+	if !m.clampToLimits {
+		return 0, errors.Errorf("target %.4f revolutions is outside the travel limits of motor (%s)",
+			positionRevolutions, m.motorName)
+	}
+	m.logger.CWarnf(ctx, "clamping target %.4f revolutions of motor (%s) to its travel limit %.4f",
+		positionRevolutions, m.motorName, limit)
+	return limit, nil
+}
+
+// limitAhead returns the target of the travel limit in the direction of rpm, in steps, if there is
+// one, so that velocity commands can run towards it in positioning mode and let the ramp generator
+// decelerate to a stop at the limit. It refuses to move further if the motor is already at or
+// beyond that limit.
+func (m *Motor) limitAhead(ctx context.Context, rpm float64) (int64, bool, error) {
+	minPos, maxPos := m.travelLimits()
+	limit := maxPos
+	if rpm < 0 {
+		limit = minPos
+	}
+	if rpm == 0 || limit == nil {
+		return 0, false, nil
+	}
+
+	pos, err := m.readPosition(ctx)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "error checking travel limits of motor (%s)", m.motorName)
+	}
+	target := m.revsToSteps(*limit - m.offsetFor(rpm))
+	if (rpm > 0 && pos >= target) || (rpm < 0 && pos <= target) {
+		return 0, false, errors.Errorf("motor (%s) is at its travel limit of %.4f revolutions", m.motorName, *limit)
+	}
+	// A limit further away than the chip can move in one go is approached in stages: the motor
+	// stops short and the next velocity command carries on from there.
+	if target-pos > math.MaxInt32 {
+		target = pos + math.MaxInt32
+	} else if pos-target > math.MaxInt32 {
+		target = pos - math.MaxInt32
+	}
+	return target, true, nil
+}
+
+// errTravelLimitReached ends an approach that ran into the travel limit in its way before it
+// touched anything.
+var errTravelLimitReached = errors.New("reached the travel limit without making contact")
+
+// checkReachedLimit returns errTravelLimitReached once a motor sent towards limit by doJog has
+// stopped there, limit being the target from limitAhead, or nil for an approach that ignores the
+// travel limits.
+func (m *Motor) checkReachedLimit(ctx context.Context, limit *int64) error {
+	if limit == nil {
+		return nil
+	}
+	pos, err := m.readPosition(ctx)
+	if err != nil {
+		return err
+	}
+	if pos == *limit {
+		return errTravelLimitReached
+	}
+	return nil
+}
+
+// measureTravel homes against the negative end of travel, then runs to the positive end, and
+// returns the distance between the two in revolutions. The axis is left zeroed at the negative end
+// (offset by home_offset_revs). With setLimits the travel, less margin at each end, becomes the
+// software travel limits until the motor is reconfigured.
+func (m *Motor) measureTravel(ctx context.Context, setLimits bool, margin float64) (map[string]interface{}, error) {
+	if m.moduloRevs != 0 {
+		return nil, errors.Errorf("can't measure the travel of motor (%s), it has no ends", m.motorName)
+	}
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+
+	rpm := math.Abs(m.homeRPM)
+	overshoot, err := m.approachEndStop(ctx, -rpm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error finding the negative end of motor (%s)", m.motorName)
+	}
+	negativeEnd := -m.homeOffset
+	if err := m.ResetZeroPosition(ctx, m.homeOffset-m.stepsToRevs(overshoot), nil); err != nil {
+		return nil, err
+	}
+	if err := m.markHomed(ctx); err != nil {
+		return nil, err
+	}
+
+	if overshoot, err = m.approachEndStop(ctx, rpm); err != nil {
+		return nil, errors.Wrapf(err, "error finding the positive end of motor (%s)", m.motorName)
+	}
+	pos, err := m.unwrappedPosition(ctx)
+	if err != nil {
+		return nil, err
+	}
+	positiveEnd := pos - m.stepsToRevs(overshoot)
+	travel := positiveEnd - negativeEnd
+
+	result := map[string]interface{}{"travel_revs": travel}
+	if !setLimits {
+		return result, nil
+	}
+	if 2*margin >= travel {
+		return nil, errors.Errorf("margin of %.4f revolutions leaves nothing of the %.4f revolutions of travel", margin, travel)
+	}
+	minPos, maxPos := negativeEnd+margin, positiveEnd-margin
+	m.mu.Lock()
+	m.minPosition, m.maxPosition = &minPos, &maxPos
+	m.mu.Unlock()
+	result["min_position_revs"] = minPos
+	result["max_position_revs"] = maxPos
+	return result, nil
+}
@@ -0,0 +1,127 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestTravelLimits(t *testing.T) {
+	ctx := context.Background()
+	minPos, maxPos := -1.0, 5.0
+	mc := testMotorConfig()
+	mc.MinPositionRevs = &minPos
+	mc.MaxPositionRevs = &maxPos
+
+	t.Run("config validation", func(t *testing.T) {
+		cfg := mc
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldBeNil)
+
+		badMax := -2.0
+		cfg.MaxPositionRevs = &badMax
+		_, _, err = cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("targets outside the limits are rejected", func(t *testing.T) {
+		_, m := makeTestMotor(t, mc, testMotorSetupTx)
+		test.That(t, m.GoTo(ctx, 50, 5.5, nil), test.ShouldNotBeNil)
+		test.That(t, m.GoTo(ctx, 50, -1.5, nil), test.ShouldNotBeNil)
+	})
+
+	t.Run("targets outside the limits are clamped", func(t *testing.T) {
+		clampConfig := mc
+		clampConfig.ClampToLimits = true
+		_, m := makeTestMotor(t, clampConfig, testMotorSetupTx)
+
+		pos, err := m.checkLimits(ctx, 7)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldEqual, 5.0)
+
+		pos, err = m.checkLimits(ctx, -3)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldEqual, -1.0)
+
+		pos, err = m.checkLimits(ctx, 2)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldEqual, 2.0)
+	})
+
+	t.Run("velocity commands stop at the limit", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+		// At 1.0 revolutions, running forward targets the 5.0 revolution limit
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 200, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{160, 0, 0, 0, 0},    // rampMode
+			{167, 0, 4, 35, 42},  // vMax
+			{173, 0, 3, 232, 0},  // xTarget
+		})
+		test.That(t, m.SetRPM(ctx, 250, nil), test.ShouldBeNil)
+
+		// Already past the -1.0 revolution limit, jogging further back is refused
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {255, 255, 0, 0, 0}},
+		)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "jog", "rpm": -100.0})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "travel limit")
+
+		// Stopping never checks the limits
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 0, 0},
+		})
+		test.That(t, m.Stop(ctx, nil), test.ShouldBeNil)
+	})
+
+	t.Run("measure_travel finds both ends", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+
+		// Negative end, zeroed there
+		expectStallGuardApproach(fakeSpiHandle, 2, []byte{0, 2, 17, 149})
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 0, 0, 0, 0},
+			{161, 0, 0, 0, 0},
+		})
+		// GSTAT is checked so that only a later chip reset unhomes the motor
+		fakeSpiHandle.AddExpectedTx([][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}})
+		// Positive end at 10 revolutions
+		expectStallGuardApproach(fakeSpiHandle, 1, []byte{0, 2, 17, 149})
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 7, 208, 0}},
+		)
+
+		resp, err := m.DoCommand(ctx, map[string]interface{}{
+			"command":     "measure_travel",
+			"set_limits":  true,
+			"margin_revs": 0.5,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["travel_revs"], test.ShouldAlmostEqual, 10.0)
+		minLimit, maxLimit := m.travelLimits()
+		test.That(t, *minLimit, test.ShouldAlmostEqual, 0.5)
+		test.That(t, *maxLimit, test.ShouldAlmostEqual, 9.5)
+	})
+}
@@ -0,0 +1,337 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for limit switches wired to a board
+// GPIO pin or digital interrupt rather than to the REFL/REFR inputs of the chip.
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/utils"
+)
+
+const (
+	// limitSwitchPollInterval is how often GPIO pin switches are read, and how often homing checks
+	// for the switch. Interrupt switches are followed as they change.
+	limitSwitchPollInterval = 10 * time.Millisecond
+	// fastStopAcceleration is the largest AMAX, used to stop at a limit switch.
+	fastStopAcceleration = math.MaxUint16
+)
+
+// LimitSwitch describes a limit switch wired to the board, given as either a GPIO pin or a digital
+// interrupt.
+type LimitSwitch struct {
+	Pin       string `json:"pin,omitempty"`
+	Interrupt string `json:"interrupt,omitempty"`
+	ActiveLow bool   `json:"active_low,omitempty"`
+	Direction string `json:"direction"` // the end of travel it is at, "positive" or "negative"
+}
+
+func (c *LimitSwitch) validate() error {
+	if (c.Pin == "") == (c.Interrupt == "") {
+		return errors.New("each limit switch needs exactly one of pin or interrupt")
+	}
+	if c.Direction != HomeDirectionPositive && c.Direction != HomeDirectionNegative {
+		return errors.Errorf("limit switch direction must be %q or %q", HomeDirectionPositive, HomeDirectionNegative)
+	}
+	return nil
+}
+
+// boardSwitch is a configured limit switch. The state of interrupt switches is kept from their
+// ticks, guarded by Motor.mu; pin switches are read when needed.
+type boardSwitch struct {
+	name      string
+	pin       board.GPIOPin
+	interrupt board.DigitalInterrupt
+	activeLow bool
+	direction float64 // the sign of the motion that runs into the switch
+	active    bool
+}
+
+// setupLimitSwitches looks up the configured limit switches on the board.
+func (m *Motor) setupLimitSwitches(b board.Board, configs []LimitSwitch) error {
+	for _, c := range configs {
+		sw := &boardSwitch{activeLow: c.ActiveLow, direction: -1}
+		if c.Direction == HomeDirectionPositive {
+			sw.direction = 1
+		}
+		var err error
+		if c.Pin != "" {
+			sw.name = c.Pin
+			if sw.pin, err = b.GPIOPinByName(c.Pin); err != nil {
+				return err
+			}
+		} else {
+			sw.name = c.Interrupt
+			if sw.interrupt, err = b.DigitalInterruptByName(c.Interrupt); err != nil {
+				return err
+			}
+		}
+		m.limitSwitches = append(m.limitSwitches, sw)
+	}
+	m.board = b
+	return nil
+}
+
+// limitSwitchFor returns the limit switch that motion in direction runs into, if there is one.
+func (m *Motor) limitSwitchFor(direction float64) *boardSwitch {
+	for _, sw := range m.limitSwitches {
+		if sw.direction*direction > 0 {
+			return sw
+		}
+	}
+	return nil
+}
+
+// switchActive reports whether a limit switch is triggered. Interrupt switches are followed from
+// their ticks, starting from the level read when their stream starts.
+func (m *Motor) switchActive(ctx context.Context, sw *boardSwitch) (bool, error) {
+	if sw.pin == nil {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return sw.active, nil
+	}
+	return m.readSwitch(ctx, sw)
+}
+
+// readSwitch reads the level of a limit switch from the board. An interrupt switch is read through
+// the GPIO pin of the same name.
+func (m *Motor) readSwitch(ctx context.Context, sw *boardSwitch) (bool, error) {
+	pin := sw.pin
+	if pin == nil {
+		var err error
+		if pin, err = m.board.GPIOPinByName(sw.name); err != nil {
+			return false, errors.Wrapf(err, "error reading limit switch %q of motor (%s)", sw.name, m.motorName)
+		}
+	}
+	high, err := pin.Get(ctx, nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "error reading limit switch %q of motor (%s)", sw.name, m.motorName)
+	}
+	return high != sw.activeLow, nil
+}
+
+// checkLimitSwitch refuses motion in direction while the limit switch it runs into is triggered.
+func (m *Motor) checkLimitSwitch(ctx context.Context, direction float64) error {
+	sw := m.limitSwitchFor(direction)
+	if sw == nil {
+		return nil
+	}
+	active, err := m.switchActive(ctx, sw)
+	if err != nil {
+		return err
+	}
+	if active {
+		return errors.Errorf("motor (%s) is at its limit switch %q", m.motorName, sw.name)
+	}
+	return nil
+}
+
+// streamLimitSwitches starts streaming the ticks of the interrupt switches until ctx is done, for
+// watchLimitSwitches to follow, and returns the channel they arrive on. Without the stream the
+// switches would neither stop the motor nor end homing, so failing to start it fails the motor.
+func (m *Motor) streamLimitSwitches(ctx context.Context) (chan board.Tick, error) {
+	var interrupts []board.DigitalInterrupt
+	for _, sw := range m.limitSwitches {
+		if sw.interrupt != nil {
+			interrupts = append(interrupts, sw.interrupt)
+		}
+	}
+	if len(interrupts) == 0 {
+		return nil, nil
+	}
+	ticks := make(chan board.Tick)
+	if err := m.board.StreamTicks(ctx, interrupts, ticks, nil); err != nil {
+		return nil, errors.Wrapf(err, "can't watch the limit switches of motor (%s)", m.motorName)
+	}
+
+	// Interrupt switches only tick when they change, so one that is already closed is read now.
+	// Ticks from since the stream started are still to come, and win.
+	for _, sw := range m.limitSwitches {
+		if sw.interrupt == nil {
+			continue
+		}
+		active, err := m.readSwitch(ctx, sw)
+		if err != nil {
+			m.logger.CWarnf(ctx, "%v, taking it to be open until it changes", err)
+			continue
+		}
+		m.mu.Lock()
+		sw.active = active
+		m.mu.Unlock()
+	}
+	return ticks, nil
+}
+
+// watchLimitSwitches follows the limit switches in the background, taking the ticks of interrupt
+// switches from streamLimitSwitches and polling pin switches, and stops the motor when it runs
+// into one.
+func (m *Motor) watchLimitSwitches(ctx context.Context, ticks <-chan board.Tick) {
+	var pins []*boardSwitch
+	byName := map[string]*boardSwitch{}
+	for _, sw := range m.limitSwitches {
+		if sw.interrupt != nil {
+			byName[sw.interrupt.Name()] = sw
+		} else {
+			pins = append(pins, sw)
+		}
+	}
+
+	// A stop can take a while, so it is made in the background while the watcher carries on
+	var stopping sync.WaitGroup
+	defer stopping.Wait()
+	trip := func(sw *boardSwitch) {
+		stopping.Add(1)
+		go func() {
+			defer stopping.Done()
+			m.limitSwitchTripped(context.WithoutCancel(ctx), sw)
+		}()
+	}
+
+	var poll <-chan time.Time
+	if len(pins) > 0 {
+		ticker := time.NewTicker(limitSwitchPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	wasActive := map[*boardSwitch]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tick := <-ticks:
+			sw, ok := byName[tick.Name]
+			if !ok {
+				continue
+			}
+			active := tick.High != sw.activeLow
+			m.mu.Lock()
+			sw.active = active
+			m.mu.Unlock()
+			if active {
+				trip(sw)
+			}
+		case <-poll:
+			for _, sw := range pins {
+				active, err := m.switchActive(ctx, sw)
+				if err != nil {
+					continue
+				}
+				if active && !wasActive[sw] {
+					trip(sw)
+				}
+				wasActive[sw] = active
+			}
+		}
+	}
+}
+
+// limitSwitchTripped stops the motor if it is running into a limit switch that has just
+// triggered. A move waiting to reach its target ends with an error, left once the motor has
+// stopped. Commands starting the motor and moves checking whether they have ended wait for the
+// stop, so they neither undo it nor see it as the move arriving. Homing against the switch stops the
+// motor itself.
+func (m *Motor) limitSwitchTripped(ctx context.Context, sw *boardSwitch) {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+	m.mu.Lock()
+	homing := m.homingSwitch == sw
+	m.mu.Unlock()
+	if homing {
+		return
+	}
+	vel, err := m.getvActual(ctx)
+	if err != nil {
+		m.logger.CErrorf(ctx, "error stopping motor (%s) at limit switch %q: %v", m.motorName, sw.name, err)
+		return
+	}
+	if float64(vel)*sw.direction <= 0 {
+		return
+	}
+	rawPos, err := m.fastStop(ctx)
+	m.mu.Lock()
+	m.pendingStop = errors.Errorf("motor (%s) ran into limit switch %q", m.motorName, sw.name)
+	m.mu.Unlock()
+	if err != nil {
+		m.logger.CErrorf(ctx, "error stopping motor (%s) at limit switch %q: %v", m.motorName, sw.name, err)
+		return
+	}
+	m.logger.CWarnf(ctx, "motor (%s) stopped at limit switch %q at %.4f revolutions",
+		m.motorName, sw.name, m.wrap(m.loadPosition(m.extendPosition(rawPos))))
+}
+
+// fastStop stops the motor as quickly as the ramp generator allows and returns XACTUAL once it
+// has come to rest. The ramp parameters of the move it stopped are restored.
+func (m *Motor) fastStop(ctx context.Context) (int32, error) {
+	m.mu.Lock()
+	rampParams := m.activeRamp
+	m.mu.Unlock()
+	return m.decelerate(ctx, fastStopAcceleration, fastStopAcceleration, rampParams)
+}
+
+// approachLimitSwitch runs the motor at rpm until the limit switch in that direction triggers,
+// stops it and returns how far past the switch it came to rest, in steps. Given the travel limit in
+// the way, the motor stops there if it doesn't find the switch first.
+func (m *Motor) approachLimitSwitch(ctx context.Context, rpm float64, limit *int64) (int64, error) {
+	sw := m.limitSwitchFor(rpm)
+	if sw == nil {
+		return 0, errors.Errorf("motor (%s) has no limit switch in the direction of %.1f rpm", m.motorName, rpm)
+	}
+	m.opMgr.CancelRunning(ctx)
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+
+	if err := m.checkLimitSwitch(ctx, rpm); err != nil {
+		return 0, errors.Wrap(err, "move it off before homing")
+	}
+	m.mu.Lock()
+	m.homingSwitch = sw
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.homingSwitch = nil
+		m.mu.Unlock()
+	}()
+	// The watcher ignores the switch while homing, so the motor is stopped here whatever happens,
+	// before the switch is handed back to the watcher
+	defer func() {
+		if err := m.doJog(context.WithoutCancel(ctx), 0, false); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+
+	if err := m.doJog(ctx, rpm, limit != nil); err != nil {
+		return 0, err
+	}
+	for {
+		active, err := m.switchActive(ctx, sw)
+		if err != nil {
+			return 0, err
+		}
+		if active {
+			break
+		}
+		if err := m.checkReachedLimit(ctx, limit); err != nil {
+			return 0, err
+		}
+		if !utils.SelectContextOrWait(ctx, limitSwitchPollInterval) {
+			return 0, errors.New("context cancelled: duration timeout trying to reach the limit switch while homing")
+		}
+	}
+
+	tripPos, err := m.readReg(ctx, xActual)
+	if err != nil {
+		return 0, err
+	}
+	rawPos, err := m.fastStop(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int64(rawPos - tripPos), nil
+}
@@ -0,0 +1,469 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/board"
+	"go.viam.com/rdk/components/board/genericlinux/buses"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/rdk/logging"
+	"go.viam.com/rdk/resource"
+	"go.viam.com/rdk/testutils/inject"
+	"go.viam.com/test"
+)
+
+func TestLimitSwitchHome(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.HomeMode = HomeModeLimitSwitch
+	mc.LimitSwitches = []LimitSwitch{{Pin: "home", Direction: HomeDirectionNegative}}
+
+	// pinAfter returns a board whose switch pin reads high from the nth read on
+	pinAfter := func(n int) *inject.Board {
+		reads := 0
+		pin := &inject.GPIOPin{GetFunc: func(ctx context.Context, extra map[string]interface{}) (bool, error) {
+			reads++
+			return reads >= n, nil
+		}}
+		b := inject.NewBoard("board")
+		b.GPIOPinByNameFunc = func(name string) (board.GPIOPin, error) {
+			return pin, nil
+		}
+		return b
+	}
+
+	t.Run("zeroes where the switch triggered", func(t *testing.T) {
+		// checked before homing and before jogging, then open for one more read
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(pinAfter(4)))
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{160, 0, 0, 0, 2},    // negative velocity mode
+				{167, 0, 2, 17, 149}, // home_rpm
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{166, 0, 0, 255, 255}, // fast stop
+				{164, 0, 0, 255, 255},
+				{163, 0, 0, 0, 0},
+				{167, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 255, 254, 122, 0}, // switch triggered at -1.95 revolutions
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 0}, // vzero
+				{0, 0, 0, 0, 0},
+				{0, 255, 254, 112, 0}, // came to rest at -2.0 revolutions
+			},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{173, 255, 254, 112, 0},
+			{164, 0, 0, 21, 8},
+			{166, 0, 0, 21, 8},
+			{170, 0, 0, 21, 8},
+			{168, 0, 0, 21, 8},
+			{163, 0, 0, 0, 1},
+			{171, 0, 0, 0, 10},
+			{165, 0, 2, 17, 149},
+			{160, 0, 0, 0, 1}, // stopped again before the watcher takes the switch back
+			{167, 0, 0, 0, 0},
+		})
+		// Resting 0.05 revolutions past the zero
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 255, 255, 246, 0},
+			{161, 255, 255, 246, 0},
+		})
+		// GSTAT is checked so that only a later chip reset unhomes the motor
+		fakeSpiHandle.AddExpectedTx([][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}})
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("stops the motor when the switch can't be read", func(t *testing.T) {
+		reads := 0
+		pin := &inject.GPIOPin{GetFunc: func(ctx context.Context, extra map[string]interface{}) (bool, error) {
+			reads++
+			if reads > 2 {
+				return false, errors.New("gpio gone")
+			}
+			return false, nil
+		}}
+		b := inject.NewBoard("board")
+		b.GPIOPinByNameFunc = func(name string) (board.GPIOPin, error) {
+			return pin, nil
+		}
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(b))
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 2},    // negative velocity mode
+			{167, 0, 2, 17, 149}, // home_rpm
+			{160, 0, 0, 0, 1},    // stopped on the way out
+			{167, 0, 0, 0, 0},
+		})
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "gpio gone")
+	})
+
+	t.Run("refuses to start on the switch", func(t *testing.T) {
+		_, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(pinAfter(1)))
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "is at its limit switch")
+	})
+
+	t.Run("only moves away from an active switch", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(pinAfter(1)))
+		err := m.SetRPM(ctx, -50, nil)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "is at its limit switch")
+
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 211, 213},
+		})
+		test.That(t, m.Jog(ctx, 50), test.ShouldBeNil)
+	})
+}
+
+func TestLimitSwitchStop(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.LimitSwitches = []LimitSwitch{{Interrupt: "stop", Direction: HomeDirectionNegative}}
+
+	interrupt := &inject.DigitalInterrupt{NameFunc: func() string { return "stop" }}
+	ticks := make(chan chan board.Tick, 1)
+	b := inject.NewBoard("board")
+	b.DigitalInterruptByNameFunc = func(name string) (board.DigitalInterrupt, error) {
+		return interrupt, nil
+	}
+	// the switch is open when the stream starts
+	b.GPIOPinByNameFunc = func(name string) (board.GPIOPin, error) {
+		return &inject.GPIOPin{GetFunc: func(ctx context.Context, extra map[string]interface{}) (bool, error) {
+			return false, nil
+		}}, nil
+	}
+	b.StreamTicksFunc = func(ctx context.Context, interrupts []board.DigitalInterrupt, ch chan board.Tick,
+		extra map[string]interface{},
+	) error {
+		ticks <- ch
+		return nil
+	}
+	fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(b))
+
+	// The running move has its own acceleration, which the stop puts back
+	rampParams := m.rampParams
+	accel := uint32(2000)
+	rampParams.A1, rampParams.AMax = &accel, &accel
+	fakeSpiHandle.AddExpectedTx([][]byte{
+		{164, 0, 0, 7, 208},
+		{166, 0, 0, 7, 208},
+		{170, 0, 0, 21, 8},
+		{168, 0, 0, 21, 8},
+		{163, 0, 0, 0, 1},
+		{171, 0, 0, 0, 10},
+		{165, 0, 2, 17, 149},
+	})
+	test.That(t, m.applyRampParameters(ctx, rampParams), test.ShouldBeNil)
+
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{
+			{34, 0, 0, 0, 0},
+			{34, 0, 0, 0, 0},
+			{166, 0, 0, 255, 255},
+			{164, 0, 0, 255, 255},
+			{163, 0, 0, 0, 0},
+			{167, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+			{33, 0, 0, 0, 0},
+			{33, 0, 0, 0, 0},
+		},
+		[][]byte{
+			{0, 0, 0, 0, 0},
+			{0, 0, 255, 255, 0}, // running in the negative direction
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 4, 0}, // vzero
+			{0, 0, 0, 0, 0},
+			{0, 255, 254, 112, 0},
+		},
+	)
+	fakeSpiHandle.AddExpectedTx([][]byte{
+		{173, 255, 254, 112, 0},
+		{164, 0, 0, 7, 208},
+		{166, 0, 0, 7, 208},
+		{170, 0, 0, 21, 8},
+		{168, 0, 0, 21, 8},
+		{163, 0, 0, 0, 1},
+		{171, 0, 0, 0, 10},
+		{165, 0, 2, 17, 149},
+	})
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := m.streamLimitSwitches(watchCtx)
+	test.That(t, err, test.ShouldBeNil)
+	watching := make(chan struct{})
+	go func() {
+		defer close(watching)
+		m.watchLimitSwitches(watchCtx, stream)
+	}()
+	ch := <-ticks
+	ch <- board.Tick{Name: "stop", High: true}
+	// the stop is made in the background, and the watcher waits for it before returning
+	ch <- board.Tick{Name: "other"}
+	cancel()
+	<-watching
+
+	err = m.stopError()
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "ran into limit switch \"stop\"")
+	test.That(t, m.checkLimitSwitch(ctx, -1), test.ShouldNotBeNil)
+	test.That(t, m.checkLimitSwitch(ctx, 1), test.ShouldBeNil)
+}
+
+func TestLimitSwitchClosedAtStart(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.LimitSwitches = []LimitSwitch{{Interrupt: "stop", ActiveLow: true, Direction: HomeDirectionPositive}}
+
+	interrupt := &inject.DigitalInterrupt{NameFunc: func() string { return "stop" }}
+	b := inject.NewBoard("board")
+	b.DigitalInterruptByNameFunc = func(name string) (board.DigitalInterrupt, error) {
+		return interrupt, nil
+	}
+	b.GPIOPinByNameFunc = func(name string) (board.GPIOPin, error) {
+		return &inject.GPIOPin{GetFunc: func(ctx context.Context, extra map[string]interface{}) (bool, error) {
+			return false, nil // active low, so closed
+		}}, nil
+	}
+	b.StreamTicksFunc = func(ctx context.Context, interrupts []board.DigitalInterrupt, ch chan board.Tick,
+		extra map[string]interface{},
+	) error {
+		return nil
+	}
+	_, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(b))
+	test.That(t, m.checkLimitSwitch(ctx, 1), test.ShouldBeNil)
+
+	// No tick ever comes, the level is read when the stream starts
+	_, err := m.streamLimitSwitches(ctx)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, m.checkLimitSwitch(ctx, 1), test.ShouldNotBeNil)
+	test.That(t, m.checkLimitSwitch(ctx, -1), test.ShouldBeNil)
+}
+
+func TestLimitSwitchStreamFails(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.LimitSwitches = []LimitSwitch{{Interrupt: "stop", Direction: HomeDirectionNegative}}
+
+	interrupt := &inject.DigitalInterrupt{NameFunc: func() string { return "stop" }}
+	b := inject.NewBoard("board")
+	b.DigitalInterruptByNameFunc = func(name string) (board.DigitalInterrupt, error) {
+		return interrupt, nil
+	}
+	b.StreamTicksFunc = func(ctx context.Context, interrupts []board.DigitalInterrupt, ch chan board.Tick,
+		extra map[string]interface{},
+	) error {
+		return errors.New("no interrupts on this board")
+	}
+	_, m := makeTestMotor(t, mc, testMotorSetupTx, withBoard(b))
+	_, err := m.streamLimitSwitches(ctx)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "no interrupts on this board")
+}
+
+func TestLimitSwitchConfig(t *testing.T) {
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.LimitSwitches = []LimitSwitch{
+		{Pin: "min", Direction: HomeDirectionNegative},
+		{Interrupt: "max", ActiveLow: true, Direction: HomeDirectionPositive},
+	}
+	deps, _, err := mc.Validate("")
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, deps, test.ShouldResemble, []string{"board"})
+
+	cfg := mc
+	cfg.BoardName = ""
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = mc
+	cfg.LimitSwitches = []LimitSwitch{{Pin: "min", Interrupt: "max", Direction: HomeDirectionNegative}}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = mc
+	cfg.LimitSwitches = []LimitSwitch{{Pin: "min", Direction: "up"}}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = mc
+	cfg.LimitSwitches = []LimitSwitch{
+		{Pin: "min", Direction: HomeDirectionNegative},
+		{Pin: "min2", Direction: HomeDirectionNegative},
+	}
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	cfg = mc
+	cfg.HomeMode = HomeModeLimitSwitch
+	cfg.LimitSwitches = mc.LimitSwitches[1:]
+	_, _, err = cfg.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "needs a limit switch in the negative direction")
+}
+
+func TestLimitSwitchStopThenGoTo(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.BoardName = "board"
+	mc.LimitSwitches = []LimitSwitch{{Interrupt: "stop", Direction: HomeDirectionNegative}}
+
+	b := inject.NewBoard("board")
+	b.DigitalInterruptByNameFunc = func(name string) (board.DigitalInterrupt, error) {
+		return &inject.DigitalInterrupt{}, nil
+	}
+	handle := newStoppingSpiHandle()
+	mot, err := makeMotor(ctx, resource.Dependencies{b.Name(): b}, mc, resource.NewName(motor.API, "motor1"),
+		logging.NewTestLogger(t), &inject.SPI{OpenHandleFunc: func() (buses.SPIHandle, error) {
+			return handle, nil
+		}})
+	test.That(t, err, test.ShouldBeNil)
+	m := mot.(*Motor)
+	t.Cleanup(func() {
+		test.That(t, m.Close(context.Background()), test.ShouldBeNil)
+	})
+
+	stopping := handle.expectStop()
+	tripped := make(chan struct{})
+	go func() {
+		defer close(tripped)
+		m.limitSwitchTripped(ctx, m.limitSwitches[0])
+	}()
+	<-stopping
+
+	// A GoTo sent while the motor is being stopped waits for the stop rather than being undone by it
+	moved := make(chan error, 1)
+	go func() {
+		moved <- m.GoTo(ctx, 50, 1.0, map[string]interface{}{"wait": false})
+	}()
+	select {
+	case err := <-moved:
+		t.Fatalf("GoTo started while the motor was being stopped: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(handle.halted)
+	<-tripped
+	test.That(t, <-moved, test.ShouldBeNil)
+	test.That(t, handle.reg(xTarget), test.ShouldEqual, 51200)
+	test.That(t, handle.reg(vMax), test.ShouldEqual, m.rpmToV(50))
+}
+
+// stoppingSpiHandle is a chip whose motor runs in the negative direction until halted is closed. It
+// keeps the registers written to it, so a test can tell which command wrote them last.
+type stoppingSpiHandle struct {
+	mu       sync.Mutex
+	regs     map[byte]int32
+	prev     byte          // the register read by the previous transfer, returned by this one
+	stopping chan struct{} // closed once VMAX is next set to zero, see expectStop
+	halted   chan struct{}
+}
+
+func newStoppingSpiHandle() *stoppingSpiHandle {
+	return &stoppingSpiHandle{
+		regs:   map[byte]int32{},
+		halted: make(chan struct{}),
+	}
+}
+
+func (h *stoppingSpiHandle) Xfer(ctx context.Context, baud uint, chipSelect string, mode uint, tx []byte) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rx := make([]byte, len(tx))
+	binary.BigEndian.PutUint32(rx[1:], uint32(h.value(h.prev)))
+
+	addr := tx[0] &^ 0x80
+	h.prev = addr
+	if tx[0]&0x80 == 0 {
+		return rx, nil
+	}
+	val := int32(binary.BigEndian.Uint32(tx[1:]))
+	h.regs[addr] = val
+	if addr == vMax && val == 0 && h.stopping != nil {
+		close(h.stopping)
+		h.stopping = nil
+	}
+	return rx, nil
+}
+
+// expectStop returns a channel closed once the motor is next told to stop.
+func (h *stoppingSpiHandle) expectStop() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopping = make(chan struct{})
+	return h.stopping
+}
+
+// value returns what reading addr gives, h.mu held.
+func (h *stoppingSpiHandle) value(addr byte) int32 {
+	halted := false
+	select {
+	case <-h.halted:
+		halted = true
+	default:
+	}
+	switch addr {
+	case vActual:
+		if halted {
+			return 0
+		}
+		return 1<<24 - 1000
+	case rampStat:
+		if halted {
+			return 0x400 // vzero
+		}
+		return 0
+	default:
+		return h.regs[addr]
+	}
+}
+
+func (h *stoppingSpiHandle) reg(addr byte) int32 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.regs[addr]
+}
+
+func (h *stoppingSpiHandle) Close() error {
+	return nil
+}
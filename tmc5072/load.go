@@ -0,0 +1,131 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for estimating the load on the motor
+// from StallGuard and the CoolStep current.
+package tmc5072
+
+import (
+	"context"
+	"math"
+
+	"github.com/pkg/errors"
+	"go.viam.com/utils"
+)
+
+// loadSpeedTolerance is how far, as a fraction, the speed may be from the one the load was
+// calibrated at. SG_RESULT varies with speed, so further off the estimate means little.
+const loadSpeedTolerance = 0.1
+
+// loadBaseline is the motor running unloaded, recorded by calibrate_load.
+type loadBaseline struct {
+	rpm      float64
+	sgResult float64
+	csActual float64
+}
+
+// loadPct estimates the load from SG_RESULT and CS_ACTUAL, as a percentage where 0 is the
+// baseline and 100 a stall at the baseline current. SG_RESULT falls towards zero as the load
+// takes up the torque in reserve, and CoolStep raising the current adds to the torque available,
+// so a load above 100 is possible.
+func (b *loadBaseline) loadPct(sgResult, csActual int32) float64 {
+	reserve := float64(sgResult) / b.sgResult
+	pct := 100 * (1 - reserve) * (float64(csActual) + 1) / (b.csActual + 1)
+	return math.Max(pct, 0)
+}
+
+// matches reports whether rpm is close enough to the baseline speed, in either direction.
+func (b *loadBaseline) matches(rpm float64) bool {
+	return math.Abs(math.Abs(rpm)-math.Abs(b.rpm)) <= loadSpeedTolerance*math.Abs(b.rpm)
+}
+
+// readLoad reads SG_RESULT and CS_ACTUAL from DRV_STATUS, and the speed in rpm.
+func (m *Motor) readLoad(ctx context.Context) (int32, int32, float64, error) {
+	status, err := m.readReg(ctx, drvStatus)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	vel, err := m.getvActual(ctx)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return status & 1023, (status >> 16) & 0x1F, m.vToRPM(vel), nil
+}
+
+// calibrateLoad records the SG_RESULT and CS_ACTUAL of the motor running unloaded at its current
+// speed as the baseline for getLoad. With stealth_chop the motor is switched to spreadCycle while
+// the readings are taken, StallGuard reads nothing useful otherwise.
+func (m *Motor) calibrateLoad(ctx context.Context) (map[string]interface{}, error) {
+	atSpeed, err := m.AtVelocity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vel, err := m.getvActual(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !atSpeed || vel == 0 {
+		return nil, errors.Errorf("motor (%s) must be running at a steady speed to calibrate its load", m.motorName)
+	}
+
+	if err := m.forceSpreadCycle(ctx, true); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := m.forceSpreadCycle(context.WithoutCancel(ctx), false); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+
+	baseline := &loadBaseline{rpm: m.vToRPM(vel)}
+	for i := 0; i < tuneSamples; i++ {
+		if !utils.SelectContextOrWait(ctx, tuneSampleTime) {
+			return nil, ctx.Err()
+		}
+		status, err := m.readReg(ctx, drvStatus)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error calibrating the load of motor (%s)", m.motorName)
+		}
+		baseline.sgResult += float64(status&1023) / tuneSamples
+		baseline.csActual += float64((status>>16)&0x1F) / tuneSamples
+	}
+	if baseline.sgResult == 0 {
+		return nil, errors.Errorf("StallGuard of motor (%s) reads zero unloaded at %.1f rpm, check sg_thresh",
+			m.motorName, math.Abs(baseline.rpm))
+	}
+
+	m.mu.Lock()
+	m.baseline = baseline
+	m.mu.Unlock()
+	return map[string]interface{}{
+		"rpm":       baseline.rpm,
+		"sg_result": baseline.sgResult,
+		"cs_actual": baseline.csActual,
+	}, nil
+}
+
+// getLoad estimates the load on the running motor against the calibrate_load baseline.
+// speed_matches is false when it runs too far from the calibrated speed for the estimate to mean
+// much.
+func (m *Motor) getLoad(ctx context.Context) (map[string]interface{}, error) {
+	m.mu.Lock()
+	baseline := m.baseline
+	m.mu.Unlock()
+	if baseline == nil {
+		return nil, errors.Errorf("motor (%s) has no load baseline, run %s first", m.motorName, CalibrateLoad)
+	}
+	sg, cs, rpm, err := m.readLoad(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in get_load from motor (%s)", m.motorName)
+	}
+	if rpm == 0 {
+		return nil, errors.Errorf("motor (%s) is not running, its load can't be estimated", m.motorName)
+	}
+	return map[string]interface{}{
+		"load_pct":       baseline.loadPct(sg, cs),
+		"sg_result":      sg,
+		"cs_actual":      cs,
+		"rpm":            rpm,
+		"calibrated_rpm": baseline.rpm,
+		"speed_matches":  baseline.matches(rpm),
+	}, nil
+}
@@ -0,0 +1,130 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+
+	// running at 50 rpm
+	vel := []byte{0, 0, 0, 211, 213}
+
+	t.Run("calibrates at the current speed", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "get_load"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "run calibrate_load first")
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, {34, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 1, 0}, {0, 0, 0, 0, 0}, vel},
+		)
+		for i := 0; i < tuneSamples; i++ {
+			fakeSpiHandle.AddExpectedRx(
+				[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}},
+				[][]byte{{0, 0, 0, 0, 0}, {0, 0, 15, 1, 144}}, // SG_RESULT 400, CS_ACTUAL 15
+			)
+		}
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "calibrate_load"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["sg_result"], test.ShouldEqual, 400.0)
+		test.That(t, resp["cs_actual"], test.ShouldEqual, 15.0)
+		test.That(t, resp["rpm"], test.ShouldAlmostEqual, 50, 0.01)
+
+		// A quarter of the reserve left at the same current
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, {34, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 15, 0, 100}, {0, 0, 0, 0, 0}, vel},
+		)
+		resp, err = m.DoCommand(ctx, map[string]interface{}{"command": "get_load"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["load_pct"], test.ShouldEqual, 75.0)
+		test.That(t, resp["speed_matches"], test.ShouldBeTrue)
+
+		// CoolStep doubling the current doubles the load it takes to use up the reserve
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, {34, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 31, 0, 100}, {0, 0, 0, 0, 0}, vel},
+		)
+		resp, err = m.DoCommand(ctx, map[string]interface{}{"command": "get_load"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["load_pct"], test.ShouldEqual, 150.0)
+	})
+
+	t.Run("refuses to calibrate a stopped motor", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, {34, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 5, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "calibrate_load"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "must be running at a steady speed")
+	})
+
+	t.Run("move_status reports the load near the calibrated speed", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		m.baseline = &loadBaseline{rpm: 50, sgResult: 400, csActual: 15}
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 15, 1, 44}, // SG_RESULT 300
+				{0, 0, 0, 0, 0},
+				{0, 0, 255, 44, 43}, // -50 rpm
+			},
+		)
+		status, err := m.DoCommand(ctx, map[string]interface{}{"command": "move_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["load_pct"], test.ShouldEqual, 25.0)
+
+		// twice as fast, too far from the calibrated speed to mean anything
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 15, 1, 44},
+				{0, 0, 0, 0, 0},
+				{0, 0, 1, 167, 170}, // 100 rpm
+			},
+		)
+		status, err = m.DoCommand(ctx, map[string]interface{}{"command": "move_status"})
+		test.That(t, err, test.ShouldBeNil)
+		_, ok := status["load_pct"]
+		test.That(t, ok, test.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for rotary axes whose position
+// wraps around every modulo_revs revolutions.
+package tmc5072
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// Values of the direction extra for GoTo on a modular axis.
+const (
+	DirectionCW       = "cw"  // increasing position
+	DirectionCCW      = "ccw" // decreasing position
+	DirectionShortest = "shortest"
+)
+
+// wrap maps a position in revolutions into [0, modulo_revs). It is the identity on linear axes.
+func (m *Motor) wrap(pos float64) float64 {
+	if m.moduloRevs == 0 {
+		return pos
+	}
+	pos = math.Mod(pos, m.moduloRevs)
+	if pos < 0 {
+		pos += m.moduloRevs
+	}
+	return pos
+}
+
+// modularTarget returns the unwrapped position nearest to current, in the given direction (0 for
+// either), that wraps to target. On linear axes target is returned unchanged.
+func (m *Motor) modularTarget(current, target float64, direction int) float64 {
+	if m.moduloRevs == 0 {
+		return target
+	}
+	delta := m.wrap(target - current)
+	switch {
+	case direction < 0 && delta > 0:
+		delta -= m.moduloRevs
+	case direction == 0 && delta > m.moduloRevs/2:
+		delta -= m.moduloRevs
+	}
+	return current + delta
+}
+
+// parseDirection reads the direction extra of GoTo, defaulting to the shortest path.
+func parseDirection(extra map[string]interface{}) (int, error) {
+	directionRaw, ok := extra[Direction]
+	if !ok {
+		return 0, nil
+	}
+	switch directionRaw {
+	case DirectionCW:
+		return 1, nil
+	case DirectionCCW:
+		return -1, nil
+	case DirectionShortest:
+		return 0, nil
+	default:
+		return 0, errors.Errorf("%s must be one of %q, %q or %q, got %v",
+			Direction, DirectionCW, DirectionCCW, DirectionShortest, directionRaw)
+	}
+}
@@ -0,0 +1,81 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestModuloAxis(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.ModuloRevs = 1
+
+	t.Run("config validation", func(t *testing.T) {
+		cfg := mc
+		maxPos := 5.0
+		cfg.MaxPositionRevs = &maxPos
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+
+	t.Run("wrapping and shortest path", func(t *testing.T) {
+		m := &Motor{moduloRevs: 1}
+		test.That(t, m.wrap(50.25), test.ShouldAlmostEqual, 0.25)
+		test.That(t, m.wrap(-0.25), test.ShouldAlmostEqual, 0.75)
+		test.That(t, m.modularTarget(50, 0.25, 0), test.ShouldAlmostEqual, 50.25)
+		test.That(t, m.modularTarget(50, 0.75, 0), test.ShouldAlmostEqual, 49.75)
+		test.That(t, m.modularTarget(50, 0.75, 1), test.ShouldAlmostEqual, 50.75)
+		test.That(t, m.modularTarget(50, 0.25, -1), test.ShouldAlmostEqual, 49.25)
+		test.That(t, m.modularTarget(50, 0, 0), test.ShouldAlmostEqual, 50.0)
+
+		linear := &Motor{}
+		test.That(t, linear.wrap(50.25), test.ShouldEqual, 50.25)
+		test.That(t, linear.modularTarget(50, 0.25, 0), test.ShouldEqual, 0.25)
+	})
+
+	t.Run("GoTo after many turns does not unwind", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		// 50 revolutions in
+		atFifty := func() {
+			fakeSpiHandle.AddExpectedRx(
+				[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+				[][]byte{{0, 0, 0, 0, 0}, {0, 0, 39, 16, 0}},
+			)
+		}
+		goToTx := func(target []byte) [][]byte {
+			return [][]byte{
+				{160, 0, 0, 0, 0},    // rampMode
+				{164, 0, 0, 21, 8},   // a1
+				{166, 0, 0, 21, 8},   // aMax
+				{170, 0, 0, 21, 8},   // d1
+				{168, 0, 0, 21, 8},   // dMax
+				{163, 0, 0, 0, 1},    // vStart
+				{171, 0, 0, 0, 10},   // vStop
+				{165, 0, 2, 17, 149}, // v1
+				{167, 0, 0, 211, 213},
+				append([]byte{173}, target...),
+			}
+		}
+
+		atFifty()
+		pos, err := m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldAlmostEqual, 0.0)
+
+		// 0.75 is a quarter turn back
+		atFifty()
+		fakeSpiHandle.AddExpectedTx(goToTx([]byte{0, 38, 222, 0}))
+		test.That(t, m.GoTo(ctx, 50, 0.75, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+
+		// unless it is asked to go clockwise
+		atFifty()
+		fakeSpiHandle.AddExpectedTx(goToTx([]byte{0, 39, 166, 0}))
+		test.That(t, m.GoTo(ctx, 50, 0.75, map[string]interface{}{"wait": false, "direction": "cw"}), test.ShouldBeNil)
+
+		test.That(t, m.GoTo(ctx, 50, 0.75, map[string]interface{}{"direction": "up"}), test.ShouldNotBeNil)
+	})
+}
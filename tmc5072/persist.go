@@ -0,0 +1,257 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for keeping the motor position
+// across module restarts, either on the chip itself or in a checkpoint file.
+package tmc5072
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.viam.com/utils"
+)
+
+// gStat is the global status register, shared by both channels. Its reset flag is set when the
+// chip powers up and stays set until cleared by writing a 1 to it.
+const (
+	gStat      = 0x01
+	gStatReset = 0x1
+)
+
+// Where the position of the motor came from, as reported by the position_status DoCommand.
+const (
+	PositionSourceReset  = "reset"  // zeroed on startup, nothing to restore
+	PositionSourceChip   = "chip"   // kept on the chip since the last run
+	PositionSourceFile   = "file"   // restored from the checkpoint file
+	PositionSourceZeroed = "zeroed" // set by ResetZeroPosition or homing
+)
+
+// pendingResets records, per chip, the channels that have yet to learn of a chip reset seen by the
+// other channel. Reading the reset flag clears it, so the first channel to start passes it on.
+var (
+	pendingResetsMu sync.Mutex
+	pendingResets   = map[string]*[2]bool{}
+)
+
+// positionCheckpoint is the content of the checkpoint file.
+type positionCheckpoint struct {
+	Position    int64   `json:"position_steps"`
+	StepsPerRev float64 `json:"steps_per_rev"`
+	AtRest      bool    `json:"at_rest"` // whether the motor was stopped at a trusted position
+}
+
+// initPosition sets up the position of a newly configured motor. With preserve_position the
+// position already on the chip is kept unless the chip has been reset since it was last
+// configured. Otherwise the checkpoint file is restored if there is one, or the position zeroed.
+// Either way a reset from before the motor was configured is taken in here, so that noticeReset
+// doesn't later mistake it for one that lost the position set up now.
+func (m *Motor) initPosition(ctx context.Context, preserve bool) error {
+	reset, err := m.chipWasReset(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "error checking for a reset of motor (%s)", m.motorName)
+	}
+	checkpoint, err := m.loadCheckpoint()
+	if err != nil {
+		m.logger.CWarnf(ctx, "ignoring position checkpoint of motor (%s): %v", m.motorName, err)
+	}
+
+	if preserve {
+		if !reset {
+			rawPos, err := m.readReg(ctx, xActual)
+			if err != nil {
+				return errors.Wrapf(err, "error reading position of motor (%s)", m.motorName)
+			}
+			// the checkpoint knows the bits above XACTUAL, if it is of the same position
+			pos := int64(rawPos)
+			if checkpoint != nil && int32(checkpoint.Position) == rawPos {
+				pos = checkpoint.Position
+			}
+			m.setPosition(pos)
+			m.setPositionSource(PositionSourceChip, true)
+			return nil
+		}
+		m.logger.CWarnf(ctx, "the chip driving motor (%s) has been reset, its position was lost", m.motorName)
+	}
+
+	var pos int64
+	source, trusted := PositionSourceReset, false
+	if checkpoint != nil {
+		pos = checkpoint.Position
+		// a checkpoint taken mid-move is only roughly where the motor ended up
+		source, trusted = PositionSourceFile, checkpoint.AtRest
+	}
+	if err := m.writeReg(ctx, xActual, int32(pos)); err != nil {
+		return err
+	}
+	m.setPosition(pos)
+	m.setPositionSource(source, trusted)
+	return nil
+}
+
+// chipWasReset reports whether the chip has been reset since this channel was last configured.
+func (m *Motor) chipWasReset(ctx context.Context) (bool, error) {
+	stat, err := m.readReg(ctx, gStat)
+	if err != nil {
+		return false, err
+	}
+
+	pendingResetsMu.Lock()
+	defer pendingResetsMu.Unlock()
+	pending, ok := pendingResets[m.chipKey]
+	if !ok {
+		pending = &[2]bool{}
+		pendingResets[m.chipKey] = pending
+	}
+	if stat&gStatReset != 0 {
+		if err := m.writeReg(ctx, gStat, gStatReset); err != nil {
+			return false, err
+		}
+		pending[2-m.index] = true
+		return true, nil
+	}
+	reset := pending[m.index-1]
+	pending[m.index-1] = false
+	return reset, nil
+}
+
+// noticeReset checks for a chip reset since the motor was configured or last checked. The position
+// is lost with a reset, so it is no longer trusted and the motor needs homing again.
+func (m *Motor) noticeReset(ctx context.Context) (bool, error) {
+	reset, err := m.chipWasReset(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "error checking for a reset of motor (%s)", m.motorName)
+	}
+	if !reset {
+		return false, nil
+	}
+	m.mu.Lock()
+	homed := m.homed
+	m.mu.Unlock()
+	if homed {
+		m.logger.CWarnf(ctx, "the chip driving motor (%s) has been reset, it needs homing again", m.motorName)
+	} else {
+		m.logger.CWarnf(ctx, "the chip driving motor (%s) has been reset, its position was lost", m.motorName)
+	}
+	m.setHomed(false)
+	m.setPositionSource(PositionSourceReset, false)
+	return true, nil
+}
+
+// setPositionSource records where the current position came from and whether it can be trusted.
+func (m *Motor) setPositionSource(source string, trusted bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.positionSource = source
+	m.positionTrusted = trusted
+}
+
+// positionStatus reports the position and whether it can be trusted.
+func (m *Motor) positionStatus(ctx context.Context) (map[string]interface{}, error) {
+	pos, err := m.Position(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return map[string]interface{}{
+		"position": pos,
+		"trusted":  m.positionTrusted,
+		"source":   m.positionSource,
+	}, nil
+}
+
+// loadCheckpoint reads the checkpoint file, returning nil if there is none.
+func (m *Motor) loadCheckpoint() (*positionCheckpoint, error) {
+	if m.positionFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(m.positionFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var checkpoint positionCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, errors.Wrapf(err, "can't parse %s", m.positionFile)
+	}
+	if checkpoint.StepsPerRev != m.stepsPerRev {
+		return nil, errors.Errorf("it was saved with %v steps per revolution, now %v", checkpoint.StepsPerRev, m.stepsPerRev)
+	}
+	return &checkpoint, nil
+}
+
+// saveCheckpoint writes the position to the checkpoint file, if one is configured. The file is
+// replaced in one step so a crash part way through never leaves it truncated. An untrusted
+// position is never saved as at rest, so it is not trusted after a restart either.
+func (m *Motor) saveCheckpoint(ctx context.Context, pos int64, atRest bool) {
+	if m.positionFile == "" {
+		return
+	}
+	m.mu.Lock()
+	atRest = atRest && m.positionTrusted
+	m.mu.Unlock()
+	checkpoint := positionCheckpoint{Position: pos, StepsPerRev: m.stepsPerRev, AtRest: atRest}
+
+	m.checkpointMu.Lock()
+	defer m.checkpointMu.Unlock()
+	if m.lastCheckpoint != nil && *m.lastCheckpoint == checkpoint {
+		return
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		m.logger.CWarnf(ctx, "error saving position of motor (%s): %v", m.motorName, err)
+		return
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(m.positionFile), filepath.Base(m.positionFile)+".*")
+	if err != nil {
+		m.logger.CWarnf(ctx, "error saving position of motor (%s): %v", m.motorName, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), m.positionFile)
+	}
+	if err != nil {
+		m.logger.CWarnf(ctx, "error saving position of motor (%s): %v", m.motorName, err)
+		utils.UncheckedError(os.Remove(tmp.Name()))
+		return
+	}
+	m.lastCheckpoint = &checkpoint
+}
+
+// markMoving saves the last checkpointed position as not at rest before the motor is set moving,
+// so that a restart before the next checkpoint doesn't trust it.
+func (m *Motor) markMoving(ctx context.Context) {
+	if m.positionFile == "" {
+		return
+	}
+	pos := m.knownPosition()
+	m.checkpointMu.Lock()
+	if m.lastCheckpoint != nil {
+		pos = m.lastCheckpoint.Position
+	}
+	m.checkpointMu.Unlock()
+	m.saveCheckpoint(ctx, pos, false)
+}
+
+// checkpoint reads the position and whether the motor is moving, and saves them.
+func (m *Motor) checkpoint(ctx context.Context) error {
+	pos, err := m.readPosition(ctx)
+	if err != nil {
+		return err
+	}
+	stopped, err := m.IsStopped(ctx)
+	if err != nil {
+		return err
+	}
+	m.saveCheckpoint(ctx, pos, stopped)
+	return nil
+}
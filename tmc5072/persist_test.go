@@ -0,0 +1,248 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestPersistPosition(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.SPIBus = "persist"
+	mc.PreservePosition = true
+	// everything makeMotor writes before checking for a reset and setting up the position
+	setupTx := testMotorSetupTx[:len(testMotorSetupTx)-3]
+
+	t.Run("position is zeroed and untrusted by default", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		status, err := m.DoCommand(ctx, map[string]interface{}{"command": "position_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["trusted"], test.ShouldBeFalse)
+		test.That(t, status["source"], test.ShouldEqual, PositionSourceReset)
+
+		// until it is zeroed on purpose
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 0, 0, 0, 0},
+			{161, 0, 0, 0, 0},
+		})
+		test.That(t, m.ResetZeroPosition(ctx, 0, nil), test.ShouldBeNil)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		status, err = m.DoCommand(ctx, map[string]interface{}{"command": "position_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["trusted"], test.ShouldBeTrue)
+		test.That(t, status["source"], test.ShouldEqual, PositionSourceZeroed)
+	})
+
+	t.Run("chip position is kept when there was no reset", func(t *testing.T) {
+		_, m := makeTestMotor(t, mc, setupTx, withSetupRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 200, 0}},
+		))
+		test.That(t, m.knownPosition(), test.ShouldEqual, 51200)
+		test.That(t, m.positionTrusted, test.ShouldBeTrue)
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceChip)
+	})
+
+	t.Run("a chip reset is passed on to the other channel", func(t *testing.T) {
+		_, m1 := makeTestMotor(t, mc, setupTx, withSetupRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {129, 0, 0, 0, 1}, {161, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 1}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		))
+		test.That(t, m1.positionTrusted, test.ShouldBeFalse)
+		test.That(t, m1.positionSource, test.ShouldEqual, PositionSourceReset)
+
+		// Channel 1 cleared the reset flag, channel 2 must still zero its position
+		mc2 := mc
+		mc2.Index = 2
+		_, m2 := makeTestMotor(t, mc2, [][]byte{
+			{252, 0, 1, 0, 195},
+			{208, 0, 6, 15, 8},
+			{253, 0, 0, 0, 0},
+			{196, 0, 0, 21, 8},
+			{198, 0, 0, 21, 8},
+			{202, 0, 0, 21, 8},
+			{200, 0, 0, 21, 8},
+			{195, 0, 0, 0, 1},
+			{203, 0, 0, 0, 10},
+			{197, 0, 2, 17, 149},
+			{209, 0, 0, 105, 234},
+			{199, 0, 0, 0, 0},
+			{192, 0, 0, 0, 1},
+		}, withSetupRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {193, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		))
+		test.That(t, m2.positionTrusted, test.ShouldBeFalse)
+		test.That(t, m2.positionSource, test.ShouldEqual, PositionSourceReset)
+	})
+
+	t.Run("a chip reset is noticed without homing", func(t *testing.T) {
+		pollConfig := testMotorConfig()
+		pollConfig.SPIBus = "persistpoll"
+		pollConfig.PositionFile = filepath.Join(t.TempDir(), "position.json")
+		fakeSpiHandle, m := makeTestMotor(t, pollConfig, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 0, 0, 0, 0},
+			{161, 0, 0, 0, 0},
+		})
+		test.That(t, m.ResetZeroPosition(ctx, 0, nil), test.ShouldBeNil)
+		test.That(t, m.positionTrusted, test.ShouldBeTrue)
+
+		// The background poll finds the reset flag, then checkpoints the lost position as untrusted
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{1, 0, 0, 0, 0},
+				{1, 0, 0, 0, 0},
+				{129, 0, 0, 0, 1},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 1},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 0},
+			},
+		)
+		test.That(t, m.trackPosition(ctx), test.ShouldBeNil)
+		test.That(t, m.positionTrusted, test.ShouldBeFalse)
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceReset)
+		data, err := os.ReadFile(pollConfig.PositionFile)
+		test.That(t, err, test.ShouldBeNil)
+		var checkpoint positionCheckpoint
+		test.That(t, json.Unmarshal(data, &checkpoint), test.ShouldBeNil)
+		test.That(t, checkpoint.AtRest, test.ShouldBeFalse)
+	})
+
+	t.Run("a reset before a restore from file is not noticed later", func(t *testing.T) {
+		fileConfig := testMotorConfig()
+		fileConfig.SPIBus = "persistfile"
+		fileConfig.PositionFile = filepath.Join(t.TempDir(), "position.json")
+		data, err := json.Marshal(positionCheckpoint{Position: 102400, StepsPerRev: 51200, AtRest: true})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, os.WriteFile(fileConfig.PositionFile, data, 0o600), test.ShouldBeNil)
+
+		// The chip has just powered up, so the reset flag is set and cleared while restoring
+		fakeSpiHandle, m := makeTestMotor(t, fileConfig, setupTx, withSetupRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {129, 0, 0, 0, 1}, {161, 0, 1, 144, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 1}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		))
+		test.That(t, m.positionTrusted, test.ShouldBeTrue)
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceFile)
+
+		// so the first check for a reset doesn't find one
+		fakeSpiHandle.AddExpectedTx([][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}})
+		reset, err := m.noticeReset(ctx)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, reset, test.ShouldBeFalse)
+		test.That(t, m.positionTrusted, test.ShouldBeTrue)
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceFile)
+	})
+
+	t.Run("checkpoint file", func(t *testing.T) {
+		fileConfig := testMotorConfig()
+		fileConfig.PositionFile = filepath.Join(t.TempDir(), "position.json")
+		data, err := json.Marshal(positionCheckpoint{Position: 102400, StepsPerRev: 51200, AtRest: true})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, os.WriteFile(fileConfig.PositionFile, data, 0o600), test.ShouldBeNil)
+
+		// Restored to 2.0 revolutions
+		fakeSpiHandle, m := makeTestMotor(t, fileConfig, setupTx, withSetupRx(
+			[][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}, {161, 0, 1, 144, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		))
+		test.That(t, m.positionTrusted, test.ShouldBeTrue)
+		test.That(t, m.positionSource, test.ShouldEqual, PositionSourceFile)
+
+		// Where a move ends up is checkpointed
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{160, 0, 0, 0, 0},
+				{164, 0, 0, 21, 8},   // a1
+				{166, 0, 0, 21, 8},   // aMax
+				{170, 0, 0, 21, 8},   // d1
+				{168, 0, 0, 21, 8},   // dMax
+				{163, 0, 0, 0, 1},    // vStart
+				{171, 0, 0, 0, 10},   // vStop
+				{165, 0, 2, 17, 149}, // v1
+				{167, 0, 0, 211, 213},
+				{173, 0, 2, 128, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 2, 0},
+			},
+		)
+		test.That(t, m.GoTo(ctx, 50, 3.2, nil), test.ShouldBeNil)
+		data, err = os.ReadFile(fileConfig.PositionFile)
+		test.That(t, err, test.ShouldBeNil)
+		var checkpoint positionCheckpoint
+		test.That(t, json.Unmarshal(data, &checkpoint), test.ShouldBeNil)
+		test.That(t, checkpoint, test.ShouldResemble, positionCheckpoint{Position: 163840, StepsPerRev: 51200, AtRest: true})
+
+		// A velocity move marks the position as stale before the motor starts moving
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 1},    // rampMode
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+		})
+		test.That(t, m.SetRPM(ctx, 50, nil), test.ShouldBeNil)
+		data, err = os.ReadFile(fileConfig.PositionFile)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, json.Unmarshal(data, &checkpoint), test.ShouldBeNil)
+		test.That(t, checkpoint, test.ShouldResemble, positionCheckpoint{Position: 163840, StepsPerRev: 51200, AtRest: false})
+
+		// A checkpoint for a different gear ratio or microstepping is ignored
+		m2 := &Motor{positionFile: fileConfig.PositionFile, stepsPerRev: 102400}
+		checkpointPtr, err := m2.loadCheckpoint()
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, checkpointPtr, test.ShouldBeNil)
+	})
+}
@@ -0,0 +1,92 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for extending the 32 bit XACTUAL
+// register into a position that does not wrap around.
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// positionPollInterval is how often XACTUAL is sampled in the background so that no wraparound
+// is missed. At the fastest the chip can step, XACTUAL covers half its range in about five minutes.
+const positionPollInterval = 10 * time.Second
+
+// extendPosition folds a fresh XACTUAL reading into the extended position and returns it, in
+// microsteps. XACTUAL wraps around at 32 bits, so the difference from the previous reading is
+// taken in 32 bit arithmetic.
+func (m *Motor) extendPosition(rawPos int32) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.position += int64(rawPos - m.lastXActual)
+	m.lastXActual = rawPos
+	return m.position
+}
+
+// setPosition records that XACTUAL has been written with the low 32 bits of pos.
+func (m *Motor) setPosition(pos int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.position = pos
+	m.lastXActual = int32(pos)
+}
+
+// knownPosition returns the extended position as of the last XACTUAL reading, in microsteps.
+func (m *Motor) knownPosition() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.position
+}
+
+// readPosition reads XACTUAL and returns the extended position in microsteps.
+func (m *Motor) readPosition(ctx context.Context) (int64, error) {
+	rawPos, err := m.readReg(ctx, xActual)
+	if err != nil {
+		return 0, err
+	}
+	return m.extendPosition(rawPos), nil
+}
+
+// chipTarget converts an extended target into the XTARGET of a move starting at pos. The ramp
+// generator takes the distance to XTARGET as a signed 32 bit value, so longer moves are refused.
+func (m *Motor) chipTarget(target, pos int64) (int32, error) {
+	if distance := target - pos; distance > math.MaxInt32 || distance < -math.MaxInt32 {
+		return 0, errors.Errorf("move of %.1f revolutions on motor (%s) is longer than the chip can make at once",
+			m.stepsToRevs(distance), m.motorName)
+	}
+	return int32(target), nil
+}
+
+// pollPosition keeps the extended position, and the checkpoint file if there is one, up to date
+// while nothing else is reading it.
+func (m *Motor) pollPosition(ctx context.Context) {
+	ticker := time.NewTicker(positionPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.trackPosition(ctx); err != nil && ctx.Err() == nil {
+				m.logger.CWarnf(ctx, "error tracking position of motor (%s): %v", m.motorName, err)
+			}
+		}
+	}
+}
+
+// trackPosition is one round of pollPosition. A chip reset is noticed first, whether or not the
+// motor is homed, so the position it lost is not checkpointed as trusted.
+func (m *Motor) trackPosition(ctx context.Context) error {
+	if _, err := m.noticeReset(ctx); err != nil {
+		return err
+	}
+	if m.positionFile != "" {
+		return m.checkpoint(ctx)
+	}
+	_, err := m.readPosition(ctx)
+	return err
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestExtendedPosition(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("wraparound of XACTUAL", func(t *testing.T) {
+		m := &Motor{}
+		test.That(t, m.extendPosition(math.MaxInt32-10), test.ShouldEqual, int64(math.MaxInt32-10))
+		test.That(t, m.extendPosition(math.MinInt32+10), test.ShouldEqual, int64(math.MaxInt32)+11)
+		test.That(t, m.extendPosition(math.MaxInt32-10), test.ShouldEqual, int64(math.MaxInt32-10))
+		test.That(t, m.extendPosition(-5), test.ShouldEqual, int64(-5))
+	})
+
+	t.Run("moves past 32 bits", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+		// One full wrap of XACTUAL in, 83886.08 revolutions
+		m.setPosition(1 << 32)
+
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},    // rampMode
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+			{173, 0, 3, 16, 0}, // 83890 revolutions, less the wrap
+		})
+		test.That(t, m.GoTo(ctx, 50, 83890, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 16, 0}},
+		)
+		pos, err := m.Position(ctx, nil)
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, pos, test.ShouldAlmostEqual, 83890.0)
+
+		// Further than the ramp generator can go in one move
+		err = m.GoTo(ctx, 50, 0, nil)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "longer than the chip can make")
+	})
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for measuring where the motor
+// touches something without re-zeroing it.
+package tmc5072
+
+import (
+	"context"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// probe runs the motor at rpm until StallGuard or a switch stops it, following trigger, and returns
+// the position where it made contact. With a reference switch that is the position latched by the
+// chip, with a limit switch the position where it triggered, with StallGuard the position the
+// motor stopped at. With retract the motor then backs off that far from where it came to rest.
+// Unlike homing the zero is left alone. The approach stops at the travel limit in its way, and a
+// probe that gets there without contact reports so.
+func (m *Motor) probe(ctx context.Context, rpm, retract float64, trigger string) (map[string]interface{}, error) {
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+
+	overshoot, err := m.approach(ctx, rpm, trigger, true)
+	if err != nil && !errors.Is(err, errTravelLimitReached) {
+		return nil, errors.Wrapf(err, "error probing with motor (%s)", m.motorName)
+	}
+	pos, posErr := m.readPosition(ctx)
+	if posErr != nil {
+		return nil, posErr
+	}
+	if err != nil {
+		return map[string]interface{}{"contact": false, "position": m.wrap(m.loadPosition(pos))}, nil
+	}
+	contact := m.loadPosition(pos - overshoot)
+	result := map[string]interface{}{"contact": true, "contact_position": m.wrap(contact)}
+	if retract == 0 {
+		return result, nil
+	}
+
+	rest := m.loadPosition(pos)
+	if rpm > 0 {
+		retract *= -1
+	}
+	// backing off only has to get clear of the contact, so the travel limits don't hold it back
+	if err := m.goTo(ctx, math.Abs(rpm), rest+retract, nil, false); err != nil {
+		return nil, errors.Wrapf(err, "error retracting motor (%s) after probing", m.motorName)
+	}
+	return result, nil
+}
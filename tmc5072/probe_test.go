@@ -0,0 +1,117 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestProbe(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reports the contact and retracts without re-zeroing", func(t *testing.T) {
+		// the retract ends below the travel limits, like the approach it isn't bound by them
+		mc := testMotorConfig()
+		minPos := 1.75
+		mc.MinPositionRevs = &minPos
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+		expectStallGuardApproach(fakeSpiHandle, 1, []byte{0, 0, 211, 213})
+		// Stopped by StallGuard at 2.0 revolutions
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 1, 144, 0}},
+		)
+		// Retract 0.5 revolutions to 1.5
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},
+			{166, 0, 0, 21, 8},
+			{170, 0, 0, 21, 8},
+			{168, 0, 0, 21, 8},
+			{163, 0, 0, 0, 1},
+			{171, 0, 0, 0, 10},
+			{165, 0, 2, 17, 149},
+			{167, 0, 0, 211, 213},
+			{173, 0, 1, 44, 0},
+		})
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 2, 0}},
+		)
+
+		resp, err := m.DoCommand(ctx, map[string]interface{}{
+			"command":      "probe",
+			"rpm":          50.0,
+			"retract_revs": 0.5,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["contact"], test.ShouldBeTrue)
+		test.That(t, resp["contact_position"], test.ShouldEqual, 2.0)
+	})
+
+	t.Run("stops at the travel limit without contact", func(t *testing.T) {
+		mc := testMotorConfig()
+		maxPos := 0.5
+		mc.MaxPositionRevs = &maxPos
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+		// Run towards the limit at 0.5 revolutions in positioning mode, and get there first
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{160, 0, 0, 0, 0},
+				{167, 0, 0, 211, 213},
+				{173, 0, 0, 100, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{180, 0, 0, 0, 0},
+				{160, 0, 0, 0, 1},
+				{167, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 100, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 100, 0},
+			},
+		)
+
+		resp, err := m.DoCommand(ctx, map[string]interface{}{
+			"command":      "probe",
+			"rpm":          50.0,
+			"retract_revs": 0.5,
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["contact"], test.ShouldBeFalse)
+		test.That(t, resp["position"], test.ShouldEqual, 0.5)
+	})
+
+	t.Run("rejects bad arguments", func(t *testing.T) {
+		_, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "probe"})
+		test.That(t, err, test.ShouldNotBeNil)
+		_, err = m.DoCommand(ctx, map[string]interface{}{"command": "probe", "rpm": 50.0, "trigger": "laser"})
+		test.That(t, err, test.ShouldNotBeNil)
+		_, err = m.DoCommand(ctx, map[string]interface{}{"command": "probe", "rpm": 50.0, "retract_revs": -1.0})
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,120 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for homing against the reference
+// switches wired to the REFL/REFR inputs of the chip.
+package tmc5072
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/utils"
+)
+
+// Values of home_mode.
+const (
+	HomeModeStallGuard = "stallguard"
+	HomeModeRefSwitch  = "ref_switch"
+	// HomeModeLimitSwitch homes against a limit switch on the board, see limitswitch.go.
+	HomeModeLimitSwitch = "limit_switch"
+)
+
+// SW_MODE bits. The left switch stops motion in the negative direction, the right switch motion in
+// the positive direction.
+const (
+	swStopLEnable   = 1 << 0
+	swStopREnable   = 1 << 1
+	swPolStopL      = 1 << 2 // active low left switch
+	swPolStopR      = 1 << 3 // active low right switch
+	swLatchLActive  = 1 << 5
+	swLatchRActive  = 1 << 7
+	swSGStop        = 1 << 10
+	swEnSoftStop    = 1 << 11
+	rampStatStopL   = 1 << 0 // left switch active
+	rampStatStopR   = 1 << 1
+	rampStatLatchL  = 1 << 2 // position latched on the left switch, cleared by reading
+	rampStatLatchR  = 1 << 3
+	rampStatEvStopL = 1 << 4 // motor stopped by the left switch
+	rampStatEvStopR = 1 << 5
+	rampStatVZero   = 1 << 10
+)
+
+// approachRefSwitch runs the motor at rpm until the reference switch in that direction stops it,
+// and returns how far past the switch it came to rest, in steps. The position where the switch
+// triggered is latched into XLATCH by the chip, so the overshoot of the soft stop does not matter.
+// Given the travel limit in the way, the motor stops there if it doesn't find the switch first.
+func (m *Motor) approachRefSwitch(ctx context.Context, rpm float64, limit *int64) (int64, error) {
+	m.opMgr.CancelRunning(ctx)
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+
+	swConfig, stopBit, latchBit, eventBit := int32(swStopLEnable|swLatchLActive), int32(rampStatStopL),
+		int32(rampStatLatchL), int32(rampStatEvStopL)
+	if m.homeSwitchActiveLow {
+		swConfig |= swPolStopL
+	}
+	if rpm > 0 {
+		swConfig, stopBit, latchBit, eventBit = swStopREnable|swLatchRActive, rampStatStopR, rampStatLatchR, rampStatEvStopR
+		if m.homeSwitchActiveLow {
+			swConfig |= swPolStopR
+		}
+	}
+	swConfig |= swEnSoftStop
+
+	// Reading RAMP_STAT also clears any stale latch flag
+	stat, err := m.readReg(ctx, rampStat)
+	if err != nil {
+		return 0, err
+	}
+	if stat&stopBit != 0 {
+		return 0, errors.Errorf("motor (%s) is already on its reference switch, move it off before homing", m.motorName)
+	}
+
+	if err := m.writeReg(ctx, swMode, swConfig); err != nil {
+		return 0, err
+	}
+	// Stop before disabling the switch, which would otherwise let the motor carry on
+	defer func() {
+		if err := m.doJog(ctx, 0, false); err != nil {
+			m.logger.CError(ctx, err)
+		}
+		if err := m.writeReg(ctx, swMode, 0); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+	if err := m.doJog(ctx, rpm, limit != nil); err != nil {
+		return 0, err
+	}
+
+	latched := false
+	for {
+		if !utils.SelectContextOrWait(ctx, 10*time.Millisecond) {
+			return 0, errors.New("context cancelled: duration timeout trying to reach the reference switch while homing")
+		}
+		stat, err := m.readReg(ctx, rampStat)
+		if err != nil {
+			return 0, err
+		}
+		latched = latched || stat&latchBit != 0
+		if stat&eventBit != 0 && stat&rampStatVZero != 0 {
+			break
+		}
+		if err := m.checkReachedLimit(ctx, limit); err != nil {
+			return 0, err
+		}
+	}
+	if !latched {
+		return 0, errors.Errorf("motor (%s) stopped at its reference switch without latching the position", m.motorName)
+	}
+
+	latch, err := m.readReg(ctx, xLatch)
+	if err != nil {
+		return 0, err
+	}
+	rawPos, err := m.readReg(ctx, xActual)
+	if err != nil {
+		return 0, err
+	}
+	return int64(rawPos - latch), nil
+}
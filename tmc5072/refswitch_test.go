@@ -0,0 +1,92 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestRefSwitchHome(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.HomeMode = HomeModeRefSwitch
+	mc.HomeSwitchActiveLow = true
+
+	t.Run("zeroes at the latched switch position", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{180, 0, 0, 8, 37},   // stop_l_enable, pol_stop_l, latch_l_active, en_softstop
+				{160, 0, 0, 0, 2},    // negative velocity mode
+				{167, 0, 2, 17, 149}, // home_rpm
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{54, 0, 0, 0, 0},
+				{54, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{160, 0, 0, 0, 1},
+				{167, 0, 0, 0, 0},
+				{180, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 4}, // latched while still moving
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 16}, // stopped by the switch
+				{0, 0, 0, 0, 0},
+				{0, 255, 254, 122, 0}, // switch triggered at -1.95 revolutions
+				{0, 0, 0, 0, 0},
+				{0, 255, 254, 112, 0}, // came to rest at -2.0 revolutions
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+		// Resting 0.05 revolutions past the zero
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 3},
+			{173, 255, 255, 246, 0},
+			{161, 255, 255, 246, 0},
+		})
+		// GSTAT is checked so that only a later chip reset unhomes the motor
+		fakeSpiHandle.AddExpectedTx([][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}})
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldBeNil)
+	})
+
+	t.Run("refuses to start on the switch", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 1}},
+		)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "already on its reference switch")
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		cfg := mc
+		cfg.HomeMode = "magnet"
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
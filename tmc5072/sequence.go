@@ -0,0 +1,144 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for running sequences of moves
+// on the driver without a round trip per move.
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.viam.com/rdk/components/motor"
+	"go.viam.com/utils"
+)
+
+// sequenceSegment is a single move within a run_sequence command.
+type sequenceSegment struct {
+	position    *float64 // absolute target in revolutions
+	revolutions *float64 // target relative to the previous segment's target
+	rpm         float64
+	rampParams  *rampParameters
+	dwell       time.Duration
+}
+
+// parseSequence converts the segments of a run_sequence command into sequenceSegments.
+func parseSequence(segmentsRaw interface{}) ([]sequenceSegment, error) {
+	segmentsList, ok := segmentsRaw.([]interface{})
+	if !ok {
+		return nil, errors.Errorf("%s must be a list, got %T", Segments, segmentsRaw)
+	}
+	if len(segmentsList) == 0 {
+		return nil, errors.Errorf("%s must contain at least one segment", Segments)
+	}
+
+	segments := make([]sequenceSegment, 0, len(segmentsList))
+	for i, segmentRaw := range segmentsList {
+		segmentMap, ok := segmentRaw.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("segment %d must be a map[string]interface{}, got %T", i, segmentRaw)
+		}
+
+		var segment sequenceSegment
+		if positionRaw, ok := segmentMap["position"]; ok {
+			position, ok := positionRaw.(float64)
+			if !ok {
+				return nil, errors.Errorf("segment %d: position must be floating point", i)
+			}
+			segment.position = &position
+		}
+		if revolutionsRaw, ok := segmentMap["revolutions"]; ok {
+			revolutions, ok := revolutionsRaw.(float64)
+			if !ok {
+				return nil, errors.Errorf("segment %d: revolutions must be floating point", i)
+			}
+			segment.revolutions = &revolutions
+		}
+		if (segment.position == nil) == (segment.revolutions == nil) {
+			return nil, errors.Errorf("segment %d: exactly one of position or revolutions must be set", i)
+		}
+
+		rpm, ok := segmentMap[RPMVal].(float64)
+		if !ok {
+			return nil, errors.Errorf("segment %d: %s must be set and floating point", i, RPMVal)
+		}
+		segment.rpm = math.Abs(rpm)
+
+		if rampParamsRaw, ok := segmentMap["ramp_parameters"]; ok {
+			rampParams, err := parseRampParametersFromExtra(rampParamsRaw)
+			if err != nil {
+				return nil, errors.Wrapf(err, "segment %d", i)
+			}
+			segment.rampParams = rampParams
+		}
+
+		if dwellRaw, ok := segmentMap["dwell_ms"]; ok {
+			dwellMs, ok := dwellRaw.(float64)
+			if !ok || dwellMs < 0 {
+				return nil, errors.Errorf("segment %d: dwell_ms must be a non-negative number", i)
+			}
+			segment.dwell = time.Duration(dwellMs * float64(time.Millisecond))
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// runSequence executes the segments back to back as a single operation. Relative segments are
+// measured from the previous segment's target so rounding does not accumulate, absolute ones on
+// modular axes take the shortest way round. Cancelling the operation stops the motor and aborts
+// the remaining segments.
+func (m *Motor) runSequence(ctx context.Context, segments []sequenceSegment) error {
+	if err := m.checkHomed(ctx); err != nil {
+		return err
+	}
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+	defer m.setActiveSegment(-1)
+
+	for _, segment := range segments {
+		if _, err := motor.CheckSpeed(segment.rpm, m.maxRPM); err != nil {
+			return err
+		}
+	}
+
+	target, err := m.unwrappedPosition(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i, segment := range segments {
+		m.setActiveSegment(i)
+
+		if segment.position != nil {
+			target = m.modularTarget(target, *segment.position, 0)
+		} else {
+			target += *segment.revolutions
+		}
+
+		rampParams := m.rampParams
+		if segment.rampParams != nil {
+			rampParams.mergeRampParameters(*segment.rampParams)
+		}
+
+		if err := m.startMove(ctx, segment.rpm, target, rampParams, true); err != nil {
+			return errors.Wrapf(err, "error in run_sequence from motor (%s), segment %d", m.motorName, i)
+		}
+		if err := m.finishMove(ctx, rampParams); err != nil {
+			return errors.Wrapf(err, "sequence aborted in segment %d", i)
+		}
+
+		if segment.dwell > 0 && !utils.SelectContextOrWait(ctx, segment.dwell) {
+			return errors.Wrapf(ctx.Err(), "sequence aborted while dwelling after segment %d", i)
+		}
+	}
+	return nil
+}
+
+// setActiveSegment records which segment of a running sequence is in progress, -1 for none.
+func (m *Motor) setActiveSegment(i int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.activeSegment = i
+}
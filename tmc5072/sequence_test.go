@@ -0,0 +1,93 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestParseSequence(t *testing.T) {
+	t.Run("valid segments", func(t *testing.T) {
+		segments, err := parseSequence([]interface{}{
+			map[string]interface{}{"position": 2.0, "rpm": 100.0},
+			map[string]interface{}{
+				"revolutions":     -0.5,
+				"rpm":             -50.0,
+				"dwell_ms":        250.0,
+				"ramp_parameters": map[string]interface{}{"a_max": 1000.0},
+			},
+		})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, segments, test.ShouldHaveLength, 2)
+		test.That(t, *segments[0].position, test.ShouldEqual, 2.0)
+		test.That(t, segments[0].revolutions, test.ShouldBeNil)
+		test.That(t, *segments[1].revolutions, test.ShouldEqual, -0.5)
+		test.That(t, segments[1].rpm, test.ShouldEqual, 50.0)
+		test.That(t, segments[1].dwell.Milliseconds(), test.ShouldEqual, 250)
+		test.That(t, *segments[1].rampParams.AMax, test.ShouldEqual, 1000)
+	})
+
+	t.Run("invalid segments", func(t *testing.T) {
+		_, err := parseSequence(nil)
+		test.That(t, err, test.ShouldNotBeNil)
+
+		_, err = parseSequence([]interface{}{})
+		test.That(t, err, test.ShouldNotBeNil)
+
+		_, err = parseSequence([]interface{}{map[string]interface{}{"rpm": 10.0}})
+		test.That(t, err.Error(), test.ShouldContainSubstring, "exactly one of position or revolutions")
+
+		_, err = parseSequence([]interface{}{map[string]interface{}{"position": 1.0, "revolutions": 1.0, "rpm": 10.0}})
+		test.That(t, err.Error(), test.ShouldContainSubstring, "exactly one of position or revolutions")
+
+		_, err = parseSequence([]interface{}{map[string]interface{}{"position": 1.0}})
+		test.That(t, err.Error(), test.ShouldContainSubstring, "rpm must be set")
+
+		_, err = parseSequence([]interface{}{map[string]interface{}{"position": 1.0, "rpm": 10.0, "dwell_ms": -1.0}})
+		test.That(t, err.Error(), test.ShouldContainSubstring, "dwell_ms")
+	})
+}
+
+func TestRunSequence(t *testing.T) {
+	ctx := context.Background()
+	fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+
+	// Starting position is 1.0 revolutions
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+		[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 200, 0}},
+	)
+	// Each segment writes its ramp, speed and target, then polls for position reached
+	for _, target := range [][]byte{{173, 0, 2, 128, 0}, {173, 0, 1, 144, 0}} {
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+			target,
+		})
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 2, 0}},
+		)
+	}
+
+	resp, err := m.DoCommand(ctx, map[string]interface{}{
+		"command": "run_sequence",
+		"segments": []interface{}{
+			map[string]interface{}{"position": 3.2, "rpm": 50.0},
+			map[string]interface{}{"revolutions": -1.2, "rpm": 50.0, "dwell_ms": 1.0},
+		},
+	})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["segments_completed"], test.ShouldEqual, 2)
+	test.That(t, m.activeSegment, test.ShouldEqual, -1)
+}
@@ -0,0 +1,169 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for detecting stalls during
+// ordinary moves with StallGuard.
+package tmc5072
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.viam.com/utils"
+)
+
+// rampStatEvStopSG is set in RAMP_STAT once StallGuard has stopped the motor. Reading RAMP_STAT
+// clears it, and with it the stop, so the motor may start again.
+const rampStatEvStopSG = 1 << 6
+
+// StallError is returned by a move that StallGuard stopped because the motor stalled.
+type StallError struct {
+	Name     string
+	Position float64 // where the motor stopped, in revolutions
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("motor (%s) stalled at %.4f revolutions", e.Name, e.Position)
+}
+
+// watchForStalls enables the StallGuard stop for a move with stall_detection configured. It is
+// only active above VCOOLTHRS, so the motor can still get up to speed. A stop left over from an
+// earlier move is forgotten.
+func (m *Motor) watchForStalls(ctx context.Context) error {
+	m.clearStop()
+	if !m.stallDetection {
+		return nil
+	}
+	m.mu.Lock()
+	m.watchingStalls = true
+	m.mu.Unlock()
+	return m.writeReg(ctx, swMode, swSGStop)
+}
+
+// stopWatchingStalls disables the StallGuard stop enabled by watchForStalls, if it still is.
+func (m *Motor) stopWatchingStalls(ctx context.Context) error {
+	m.mu.Lock()
+	watching := m.watchingStalls
+	m.watchingStalls = false
+	m.mu.Unlock()
+	if !watching {
+		return nil
+	}
+	return m.writeReg(ctx, swMode, 0)
+}
+
+// readRampStat reads RAMP_STAT. Since reading it releases a StallGuard stop, while stalls are
+// watched for a motor that has come to a halt is put in hold mode first, so that it can't start
+// again before the stall is seen. Whichever caller sees the stall holds the motor where it stopped.
+func (m *Motor) readRampStat(ctx context.Context) (int32, error) {
+	m.mu.Lock()
+	watching := m.watchingStalls
+	m.mu.Unlock()
+	if !watching {
+		return m.readReg(ctx, rampStat)
+	}
+
+	m.rampStatMu.Lock()
+	defer m.rampStatMu.Unlock()
+	// StallGuard stops the motor dead, otherwise it only halts at the ends of a move
+	vel, err := m.getvActual(ctx)
+	if err != nil {
+		return 0, err
+	}
+	mode := int32(-1)
+	if vel == 0 {
+		if mode, err = m.readReg(ctx, rampMode); err != nil {
+			return 0, err
+		}
+		if err := m.writeReg(ctx, rampMode, modeHold); err != nil {
+			return 0, err
+		}
+	}
+	stat, err := m.readReg(ctx, rampStat)
+	if err == nil && stat&rampStatEvStopSG != 0 {
+		err = m.holdStalled(ctx)
+	}
+	if mode >= 0 {
+		err = multierr.Combine(err, m.writeReg(ctx, rampMode, mode))
+	}
+	return stat, err
+}
+
+// holdStalled keeps a motor that StallGuard stopped from starting again, counts the stall and
+// leaves a StallError for the operation waiting on the move to collect.
+func (m *Motor) holdStalled(ctx context.Context) error {
+	rawPos, err := m.readReg(ctx, xActual)
+	if err != nil {
+		return err
+	}
+	if err := m.writeReg(ctx, vMax, 0); err != nil {
+		return err
+	}
+	if err := m.writeReg(ctx, xTarget, rawPos); err != nil {
+		return err
+	}
+	if err := m.stopWatchingStalls(ctx); err != nil {
+		return err
+	}
+	stallErr := &StallError{Name: m.motorName, Position: m.wrap(m.loadPosition(m.extendPosition(rawPos)))}
+	m.logger.CWarn(ctx, stallErr)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stallCount++
+	m.lastStall = stallErr
+	m.pendingStop = stallErr
+	return nil
+}
+
+// stopError returns the error of a stall or limit switch that ended the current move, if there was
+// one. It stays with the move, for wait_for_move and move_status to report, until the next one
+// starts.
+func (m *Motor) stopError() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pendingStop
+}
+
+// clearStop forgets the stop of the previous move as a new one starts.
+func (m *Motor) clearStop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pendingStop = nil
+}
+
+// monitorStalls watches a move that nothing waits on for stalls, until the operation is replaced
+// or the motor stalls, or with untilReached once the move reaches its target. The stall is logged
+// and counted, and left for wait_for_move and move_status.
+func (m *Motor) monitorStalls(ctx context.Context, done func(), untilReached bool) {
+	defer m.activeBackgroundWorkers.Done()
+	defer done()
+	defer func() {
+		if err := m.stopWatchingStalls(context.WithoutCancel(ctx)); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+	for utils.SelectContextOrWait(ctx, 10*time.Millisecond) {
+		stat, err := m.readRampStat(ctx)
+		if err != nil {
+			m.logger.CError(ctx, err)
+			return
+		}
+		if m.stopError() != nil || (untilReached && (stat>>9)&0x1 == 1) {
+			return
+		}
+	}
+}
+
+// stallStatus reports how many stalls have been detected since the motor was configured, and
+// where the last one happened.
+func (m *Motor) stallStatus() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	status := map[string]interface{}{"stall_count": m.stallCount}
+	if m.lastStall != nil {
+		status["last_stall_position"] = m.lastStall.Position
+	}
+	return status
+}
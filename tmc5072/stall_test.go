@@ -0,0 +1,223 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"go.viam.com/test"
+)
+
+func TestStallDetection(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.StallDetection = true
+
+	rampTx := [][]byte{
+		{164, 0, 0, 21, 8},   // a1
+		{166, 0, 0, 21, 8},   // aMax
+		{170, 0, 0, 21, 8},   // d1
+		{168, 0, 0, 21, 8},   // dMax
+		{163, 0, 0, 0, 1},    // vStart
+		{171, 0, 0, 0, 10},   // vStop
+		{165, 0, 2, 17, 149}, // v1
+	}
+	// expectStall queues the reads that find the motor halted in ramp mode, held there while
+	// RAMP_STAT reports a StallGuard stop at 1.0 revolutions, and the writes that keep it there.
+	expectStall := func(fakeSpiHandle *fakeSpiHandle, mode byte) {
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{32, 0, 0, 0, 0},
+				{32, 0, 0, 0, 0},
+				{160, 0, 0, 0, 3}, // hold
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{167, 0, 0, 0, 0},
+				{173, 0, 0, 200, 0},
+				{180, 0, 0, 0, 0},
+				{160, 0, 0, 0, mode},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0}, // halted
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, mode},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 64}, // event_stop_sg
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+	}
+
+	t.Run("GoTo ends with a StallError", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{180, 0, 0, 4, 0}, // sg_stop
+			{160, 0, 0, 0, 0},
+		})
+		fakeSpiHandle.AddExpectedTx(rampTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{167, 0, 0, 211, 213},
+			{173, 0, 3, 232, 0},
+		})
+		expectStall(fakeSpiHandle, 0)
+
+		err := m.GoTo(ctx, 50, 5.0, nil)
+		var stallErr *StallError
+		test.That(t, errors.As(err, &stallErr), test.ShouldBeTrue)
+		test.That(t, stallErr.Position, test.ShouldEqual, 1.0)
+
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "stall_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["stall_count"], test.ShouldEqual, 1)
+		test.That(t, resp["last_stall_position"], test.ShouldEqual, 1.0)
+	})
+
+	t.Run("SetRPM stops on a stall", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{180, 0, 0, 4, 0}, // sg_stop
+			{160, 0, 0, 0, 1},
+		})
+		fakeSpiHandle.AddExpectedTx(rampTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{{167, 0, 0, 211, 213}})
+		expectStall(fakeSpiHandle, 1)
+
+		test.That(t, m.SetRPM(ctx, 50, nil), test.ShouldBeNil)
+		m.activeBackgroundWorkers.Wait()
+		test.That(t, m.stallStatus()["stall_count"], test.ShouldEqual, 1)
+	})
+
+	t.Run("a moving motor is not held", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{180, 0, 0, 4, 0}, // sg_stop
+			{160, 0, 0, 0, 0},
+		})
+		fakeSpiHandle.AddExpectedTx(rampTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{167, 0, 0, 211, 213},
+			{173, 0, 3, 232, 0},
+		})
+		// Still running, then halted at the target
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{32, 0, 0, 0, 0},
+				{32, 0, 0, 0, 0},
+				{160, 0, 0, 0, 3},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{160, 0, 0, 0, 0},
+				{180, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 211, 213},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 6, 0}, // position reached, vzero
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+		test.That(t, m.GoTo(ctx, 50, 5.0, nil), test.ShouldBeNil)
+		test.That(t, m.stallStatus()["stall_count"], test.ShouldEqual, 0)
+	})
+
+	t.Run("GoTo without waiting is watched in the background", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{180, 0, 0, 4, 0}, // sg_stop
+			{160, 0, 0, 0, 0},
+		})
+		fakeSpiHandle.AddExpectedTx(rampTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{167, 0, 0, 211, 213},
+			{173, 0, 3, 232, 0},
+		})
+		expectStall(fakeSpiHandle, 0)
+
+		test.That(t, m.GoTo(ctx, 50, 5.0, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+		m.activeBackgroundWorkers.Wait()
+		test.That(t, m.stallStatus()["stall_count"], test.ShouldEqual, 1)
+		test.That(t, m.watchingStalls, test.ShouldBeFalse)
+	})
+
+	t.Run("wait_for_move after a stall without waiting", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{180, 0, 0, 4, 0}, // sg_stop
+			{160, 0, 0, 0, 0},
+		})
+		fakeSpiHandle.AddExpectedTx(rampTx)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{167, 0, 0, 211, 213},
+			{173, 0, 3, 232, 0},
+		})
+		expectStall(fakeSpiHandle, 0)
+
+		test.That(t, m.GoTo(ctx, 50, 5.0, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+		m.activeBackgroundWorkers.Wait()
+
+		// Held at the stall, so the ramp generator reports the position reached
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 6, 0},
+			},
+		)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "wait_for_move", "timeout_ms": 1000.0})
+		var stallErr *StallError
+		test.That(t, errors.As(err, &stallErr), test.ShouldBeTrue)
+		test.That(t, stallErr.Position, test.ShouldEqual, 1.0)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 6, 0},
+			},
+		)
+		status, err := m.DoCommand(ctx, map[string]interface{}{"command": "move_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["position"], test.ShouldAlmostEqual, 1.0)
+		test.That(t, status["remaining"], test.ShouldAlmostEqual, 4.0)
+		test.That(t, status["reached"], test.ShouldBeFalse)
+		test.That(t, status["stalled"], test.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,189 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for tuning the StallGuard threshold.
+package tmc5072
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+	"go.viam.com/utils"
+)
+
+// The StallGuard threshold (SGT) is a 7 bit signed field of COOLCONF. Raising it raises
+// SG_RESULT, making stall detection less sensitive.
+const (
+	sgThreshMin = -64
+	sgThreshMax = 63
+)
+
+const (
+	// tuneSGMargin is how far above zero the unloaded SG_RESULT must stay at the recommended
+	// threshold, so that the motor running freely is never mistaken for a stall.
+	tuneSGMargin = 100
+	// tuneSamples is the number of SG_RESULT readings taken at each threshold tried.
+	tuneSamples    = 8
+	tuneSampleTime = 10 * time.Millisecond
+)
+
+// coolConfSFilt enables the StallGuard filter, which averages SG_RESULT over four full steps.
+const coolConfSFilt = 1 << 24
+
+// coolConfSGThresh returns the COOLCONF bits holding the StallGuard threshold.
+func coolConfSGThresh(sgThresh int32) int32 {
+	return (sgThresh & 0x7F) << 16
+}
+
+// coolConfValue returns COOLCONF with the StallGuard threshold sgThresh and the other fields as
+// currently set.
+func (m *Motor) coolConfValue(sgThresh int32) int32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value := coolConfSGThresh(sgThresh) | m.coolStep
+	if m.sgFilter {
+		value |= coolConfSFilt
+	}
+	return value
+}
+
+// writeCoolConf writes COOLCONF as currently set.
+func (m *Motor) writeCoolConf(ctx context.Context) error {
+	m.mu.Lock()
+	sgThresh := m.sgThresh
+	m.mu.Unlock()
+	return m.writeReg(ctx, coolConf, m.coolConfValue(sgThresh))
+}
+
+// sgStats summarises the SG_RESULT readings taken at one threshold.
+type sgStats struct {
+	min, mean float64
+}
+
+// sampleSG reads SG_RESULT tuneSamples times while the motor runs.
+func (m *Motor) sampleSG(ctx context.Context) (sgStats, error) {
+	stats := sgStats{min: math.Inf(1)}
+	for i := 0; i < tuneSamples; i++ {
+		if !utils.SelectContextOrWait(ctx, tuneSampleTime) {
+			return stats, ctx.Err()
+		}
+		sg, err := m.GetSG(ctx)
+		if err != nil {
+			return stats, err
+		}
+		stats.min = math.Min(stats.min, float64(sg))
+		stats.mean += float64(sg) / tuneSamples
+	}
+	return stats, nil
+}
+
+// tuneStallGuard runs the motor unloaded at rpm, away from the end stop homing runs into, and
+// finds the lowest (most sensitive) StallGuard threshold at which SG_RESULT stays clear of zero.
+// VCOOLTHRS, below which StallGuard is disabled, is recommended at half that speed. With apply
+// both are written to the chip and used until the motor is reconfigured, and the load has to be
+// calibrated again; otherwise the threshold is put back as it was. The motor runs in spreadCycle
+// throughout, even with stealth_chop.
+func (m *Motor) tuneStallGuard(ctx context.Context, rpm float64, apply bool) (map[string]interface{}, error) {
+	ctx, done := m.opMgr.New(ctx)
+	defer done()
+
+	rpm = math.Abs(rpm)
+	if m.homeRPM > 0 {
+		rpm *= -1
+	}
+	// StallGuard only works in spreadCycle
+	if err := m.forceSpreadCycle(ctx, true); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := multierr.Combine(
+			m.doJog(ctx, 0, false),
+			m.writeCoolConf(ctx),
+			m.forceSpreadCycle(context.WithoutCancel(ctx), false),
+		); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+	if err := m.doJog(ctx, rpm, true); err != nil {
+		return nil, err
+	}
+	if err := m.waitForVelocity(ctx); err != nil {
+		return nil, err
+	}
+
+	// SG_RESULT rises with the threshold, so bisect for the lowest one that passes. sgThreshMax+1
+	// stands for none passing.
+	var best sgStats
+	lo, hi := int32(sgThreshMin), int32(sgThreshMax+1)
+	for lo < hi {
+		sgThresh := (lo + hi) >> 1
+		if err := m.writeReg(ctx, coolConf, m.coolConfValue(sgThresh)); err != nil {
+			return nil, err
+		}
+		stats, err := m.sampleSG(ctx)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error tuning StallGuard of motor (%s)", m.motorName)
+		}
+		if stats.min >= tuneSGMargin {
+			hi, best = sgThresh, stats
+		} else {
+			lo = sgThresh + 1
+		}
+	}
+	if lo > sgThreshMax {
+		return nil, errors.Errorf("StallGuard of motor (%s) reads below %d unloaded at %.1f rpm even at the highest threshold, try a faster rpm",
+			m.motorName, tuneSGMargin, math.Abs(rpm))
+	}
+
+	// A move that hit a travel limit or stalled part way through gives meaningless readings
+	atSpeed, err := m.AtVelocity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !atSpeed {
+		return nil, errors.Errorf("motor (%s) did not keep running at %.1f rpm while tuning StallGuard, make sure it can turn freely",
+			m.motorName, math.Abs(rpm))
+	}
+
+	coolRPM := math.Abs(rpm) / 2
+	vCool := m.rpmToV(coolRPM)
+	if apply {
+		if err := m.writeReg(ctx, vCoolThres, vCool); err != nil {
+			return nil, err
+		}
+		// SG_RESULT means something else at the new threshold
+		m.mu.Lock()
+		m.sgThresh = lo
+		m.baseline = nil
+		m.mu.Unlock()
+	}
+	return map[string]interface{}{
+		"sg_thresh":      lo,
+		"vcoolthrs":      vCool,
+		"vcoolthrs_rpm":  coolRPM,
+		"sg_result_min":  best.min,
+		"sg_result_mean": best.mean,
+		"applied":        apply,
+	}, nil
+}
+
+// waitForVelocity waits for the motor to reach the speed it was last set to.
+func (m *Motor) waitForVelocity(ctx context.Context) error {
+	for fails := 0; ; fails++ {
+		if !utils.SelectContextOrWait(ctx, 10*time.Millisecond) {
+			return errors.Wrapf(ctx.Err(), "motor (%s) did not get up to speed", m.motorName)
+		}
+		ready, err := m.AtVelocity(ctx)
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+		if fails >= 500 {
+			return errors.Errorf("over 500 failures waiting for motor (%s) to get up to speed", m.motorName)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestTuneStallGuard(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+
+	// expectTuning queues the traffic of a tuning run at 125 rpm, away from the (negative) end
+	// stop, on a motor whose SG_RESULT reads 0 below the threshold sgThresh and 300 from it on.
+	expectTuning := func(fakeSpiHandle *fakeSpiHandle, sgThresh int32, tried []int32) {
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{160, 0, 0, 0, 1},
+				{167, 0, 2, 17, 149},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 1, 0}, // at velocity
+			},
+		)
+		for _, sgt := range tried {
+			fakeSpiHandle.AddExpectedTx([][]byte{{237, 0, byte(sgt & 0x7F), 0, 0}})
+			sg := []byte{0, 0, 0, 0, 0}
+			if sgt >= sgThresh {
+				sg = []byte{0, 0, 0, 1, 44}
+			}
+			for i := 0; i < tuneSamples; i++ {
+				fakeSpiHandle.AddExpectedRx(
+					[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}},
+					[][]byte{{0, 0, 0, 0, 0}, sg},
+				)
+			}
+		}
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 1, 0}},
+		)
+	}
+
+	t.Run("recommends the lowest threshold clear of zero", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		expectTuning(fakeSpiHandle, 5, []int32{0, 32, 16, 8, 4, 6, 5})
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 0, 0},
+			{237, 0, 0, 0, 0}, // threshold put back
+		})
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "tune_stallguard"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["sg_thresh"], test.ShouldEqual, int32(5))
+		test.That(t, resp["vcoolthrs"], test.ShouldEqual, int32(67786))
+		test.That(t, resp["sg_result_min"], test.ShouldEqual, 300.0)
+		test.That(t, resp["applied"], test.ShouldBeFalse)
+	})
+
+	t.Run("applies a negative threshold", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+		expectTuning(fakeSpiHandle, -3, []int32{0, -32, -16, -8, -4, -2, -3})
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{177, 0, 1, 8, 202}, // VCOOLTHRS at 62.5 rpm
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 0, 0},
+			{237, 0, 125, 0, 0}, // -3 as 7 bit two's complement
+		})
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "tune_stallguard", "apply": true})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["sg_thresh"], test.ShouldEqual, int32(-3))
+		test.That(t, m.sgThresh, test.ShouldEqual, int32(-3))
+	})
+
+	t.Run("clamps and encodes sg_thresh from config", func(t *testing.T) {
+		cfg := mc
+		cfg.SGThresh = -100
+		setupTx := append([][]byte{}, testMotorSetupTx...)
+		setupTx[2] = []byte{237, 0, 64, 0, 0}
+		_, m := makeTestMotor(t, cfg, setupTx)
+		test.That(t, m.sgThresh, test.ShouldEqual, int32(-64))
+	})
+}
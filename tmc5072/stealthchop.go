@@ -0,0 +1,101 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for the quiet stealthChop chopper
+// mode.
+package tmc5072
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const (
+	// add 0x08 for motor 2. The TMC5072 has no chip wide stealthChop switch, each channel runs the
+	// voltage PWM set up in its own PWMCONF below its own VHIGH. VHIGH resets to zero, so a channel
+	// that does not configure stealthChop stays in spreadCycle.
+	pwmConf = 0x10
+
+	// add 0x20 for motor 2. Above VHIGH the channel switches from stealthChop to spreadCycle.
+	vHigh    = 0x32
+	maxVHigh = 1<<23 - 1
+
+	pwmConfAutoscale = 1 << 18
+)
+
+// StealthChop configures the stealthChop voltage PWM mode, which runs the motor near silently at
+// low speed. StallGuard needs spreadCycle, so homing always uses spreadCycle, and stall detection
+// only works above spreadcycle_rpm.
+type StealthChop struct {
+	SpreadCycleRPM float64 `json:"spreadcycle_rpm,omitempty"` // switch to spreadCycle above this speed, 0 never
+	PWMAmpl        *int    `json:"pwm_ampl,omitempty"`        // 0-255, the amplitude limit with autoscale, 128 default
+	PWMGrad        *int    `json:"pwm_grad,omitempty"`        // 0-255, the amplitude regulation loop gradient, 4 default
+	PWMFreq        *int    `json:"pwm_freq,omitempty"`        // 0-3 for 2/1024, 2/683, 2/512 or 2/410 of fCLK, 1 default
+	PWMAutoscale   *bool   `json:"pwm_autoscale,omitempty"`   // regulate the amplitude to the motor current, true default
+}
+
+// validate checks the stealthChop settings against the PWMCONF field sizes.
+func (sc *StealthChop) validate() error {
+	if sc == nil {
+		return nil
+	}
+	checkRange := func(name string, val *int, vMax int) error {
+		if val != nil && (*val < 0 || *val > vMax) {
+			return errors.Errorf("%s must be between 0 and %d, got %d", name, vMax, *val)
+		}
+		return nil
+	}
+	if sc.SpreadCycleRPM < 0 {
+		return errors.New("spreadcycle_rpm must not be negative")
+	}
+	return multierr.Combine(
+		checkRange("pwm_ampl", sc.PWMAmpl, 255),
+		checkRange("pwm_grad", sc.PWMGrad, 255),
+		checkRange("pwm_freq", sc.PWMFreq, 3),
+	)
+}
+
+// pwmConfValue returns PWMCONF for the settings, with the chip's reset values as defaults.
+func (sc *StealthChop) pwmConfValue() int32 {
+	ampl, grad, freq := int32(128), int32(4), int32(1)
+	if sc.PWMAmpl != nil {
+		ampl = int32(*sc.PWMAmpl)
+	}
+	if sc.PWMGrad != nil {
+		grad = int32(*sc.PWMGrad)
+	}
+	if sc.PWMFreq != nil {
+		freq = int32(*sc.PWMFreq)
+	}
+	value := ampl | grad<<8 | freq<<16
+	if sc.PWMAutoscale == nil || *sc.PWMAutoscale {
+		value |= pwmConfAutoscale
+	}
+	return value
+}
+
+// setupStealthChop enables stealthChop on this channel, leaving the other channel alone.
+func (m *Motor) setupStealthChop(ctx context.Context, sc *StealthChop) error {
+	m.vHigh = maxVHigh
+	if sc.SpreadCycleRPM > 0 && sc.SpreadCycleRPM < m.maxRPM {
+		m.vHigh = m.rpmToV(sc.SpreadCycleRPM)
+	}
+	err := multierr.Combine(
+		m.writeReg(ctx, pwmConf, sc.pwmConfValue()),
+		m.writeReg(ctx, vHigh, m.vHigh),
+	)
+	return errors.Wrapf(err, "error enabling stealthChop for motor (%s)", m.motorName)
+}
+
+// forceSpreadCycle keeps the channel in spreadCycle at every speed, as StallGuard needs, or puts
+// back the configured switchover. It does nothing unless stealthChop is configured.
+func (m *Motor) forceSpreadCycle(ctx context.Context, force bool) error {
+	if !m.stealthChop {
+		return nil
+	}
+	if force {
+		return m.writeReg(ctx, vHigh, 0)
+	}
+	return m.writeReg(ctx, vHigh, m.vHigh)
+}
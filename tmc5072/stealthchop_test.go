@@ -0,0 +1,126 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestStealthChop(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.StealthChop = &StealthChop{SpreadCycleRPM: 100}
+
+	// stealthChop is set up after the ramp generator, before the position is zeroed
+	n := len(testMotorSetupTx) - 3
+	setupTx := append([][]byte{}, testMotorSetupTx[:n]...)
+	setupTx = append(setupTx,
+		[]byte{144, 0, 5, 4, 128},   // PWMCONF reset values
+		[]byte{178, 0, 1, 167, 170}, // VHIGH at 100 rpm
+	)
+	setupTx = append(setupTx, testMotorSetupTx[n:]...)
+	forceTx := []byte{178, 0, 0, 0, 0}       // VHIGH 0, spreadCycle at every speed
+	restoreTx := []byte{178, 0, 1, 167, 170} // back to switching at 100 rpm
+
+	t.Run("homing forces spreadCycle", func(t *testing.T) {
+		cfg := mc
+		cfg.HomeMode = HomeModeRefSwitch
+		fakeSpiHandle, m := makeTestMotor(t, cfg, setupTx)
+
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				forceTx,
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				restoreTx,
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 1}, // already on the switch
+				{0, 0, 0, 0, 0},
+			},
+		)
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "already on its reference switch")
+	})
+
+	t.Run("tuning StallGuard forces spreadCycle throughout", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, setupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				forceTx,
+				{160, 0, 0, 0, 1},
+				{167, 0, 2, 17, 149},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 1, 0}, // at velocity
+			},
+		)
+		// SG_RESULT reads 0 at every threshold, so tuning gives up
+		for _, sgt := range []int32{0, 32, 48, 56, 60, 62, 63} {
+			fakeSpiHandle.AddExpectedTx([][]byte{{237, 0, byte(sgt), 0, 0}})
+			for i := 0; i < tuneSamples; i++ {
+				fakeSpiHandle.AddExpectedRx(
+					[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}},
+					[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+				)
+			}
+		}
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 0, 0},
+			{237, 0, 0, 0, 0},
+			restoreTx,
+		})
+		_, err := m.DoCommand(ctx, map[string]interface{}{"command": "tune_stallguard"})
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "even at the highest threshold")
+	})
+
+	t.Run("calibrating the load forces spreadCycle", func(t *testing.T) {
+		fakeSpiHandle, m := makeTestMotor(t, mc, setupTx)
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, {34, 0, 0, 0, 0}, forceTx},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 1, 0}, {0, 0, 0, 0, 0}, {0, 0, 0, 211, 213}, {0, 0, 0, 0, 0}},
+		)
+		for i := 0; i < tuneSamples; i++ {
+			fakeSpiHandle.AddExpectedRx(
+				[][]byte{{111, 0, 0, 0, 0}, {111, 0, 0, 0, 0}},
+				[][]byte{{0, 0, 0, 0, 0}, {0, 0, 15, 1, 144}},
+			)
+		}
+		fakeSpiHandle.AddExpectedTx([][]byte{restoreTx})
+		resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "calibrate_load"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, resp["sg_result"], test.ShouldEqual, 400.0)
+	})
+
+	t.Run("PWMCONF fields", func(t *testing.T) {
+		ampl, grad, freq, autoscale := 200, 1, 2, false
+		sc := &StealthChop{PWMAmpl: &ampl, PWMGrad: &grad, PWMFreq: &freq, PWMAutoscale: &autoscale}
+		test.That(t, sc.pwmConfValue(), test.ShouldEqual, int32(0x000201C8))
+	})
+
+	t.Run("config validation", func(t *testing.T) {
+		freq := 4
+		cfg := mc
+		cfg.StealthChop = &StealthChop{PWMFreq: &freq}
+		_, _, err := cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+
+		cfg.StealthChop = &StealthChop{SpreadCycleRPM: -1}
+		_, _, err = cfg.Validate("")
+		test.That(t, err, test.ShouldNotBeNil)
+	})
+}
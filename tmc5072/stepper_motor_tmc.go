@@ -38,6 +38,9 @@ type rampParameters struct {
 	DMax   *uint32 `json:"d_max,omitempty"`
 }
 
+// maxVMax is the fastest VMAX the chip accepts.
+const maxVMax = 1<<23 - 512
+
 // validate checks that all non-nil ramp parameters are within the valid range [0, 2^23].
 func (rp *rampParameters) validate() error {
 	if rp == nil {
@@ -68,7 +71,7 @@ func (rp *rampParameters) validate() error {
 	if err := checkRange("d1", rp.D1, 1, uint32(math.Pow(2, 16))-1); err != nil {
 		return err
 	}
-	if err := checkRange("v_max", rp.VMax, 0, uint32(math.Pow(2, 23))-512); err != nil {
+	if err := checkRange("v_max", rp.VMax, 0, maxVMax); err != nil {
 		return err
 	}
 	if err := checkRange("a_max", rp.AMax, 0, uint32(math.Pow(2, 16))-1); err != nil {
@@ -83,21 +86,47 @@ func (rp *rampParameters) validate() error {
 
 // Config describes the configuration of a motor.
 type Config struct {
-	Pins             PinConfig      `json:"pins,omitempty"`
-	BoardName        string         `json:"board,omitempty"` // used solely for the PinConfig
-	MaxRPM           float64        `json:"max_rpm,omitempty"`
-	MaxAcceleration  float64        `json:"max_acceleration_rpm_per_sec,omitempty"`
-	TicksPerRotation int            `json:"ticks_per_rotation"`
-	SPIBus           string         `json:"spi_bus"`
-	ChipSelect       string         `json:"chip_select"`
-	Index            int            `json:"index"`
-	SGThresh         int32          `json:"sg_thresh,omitempty"`
-	HomeRPM          float64        `json:"home_rpm,omitempty"`
-	CalFactor        float64        `json:"cal_factor,omitempty"`
-	RunCurrent       int32          `json:"run_current,omitempty"`  // 1-32 as a percentage of rsense voltage, 15 default
-	HoldCurrent      int32          `json:"hold_current,omitempty"` // 1-32 as a percentage of rsense voltage, 8 default
-	HoldDelay        int32          `json:"hold_delay,omitempty"`   // 0=instant powerdown, 1-15=delay * 2^18 clocks, 6 default
-	RampParameters   rampParameters `json:"ramp_parameters,omitempty"`
+	Pins                PinConfig      `json:"pins,omitempty"`
+	BoardName           string         `json:"board,omitempty"` // used solely for the PinConfig
+	MaxRPM              float64        `json:"max_rpm,omitempty"`
+	MaxAcceleration     float64        `json:"max_acceleration_rpm_per_sec,omitempty"`
+	TicksPerRotation    int            `json:"ticks_per_rotation"`
+	GearRatio           float64        `json:"gear_ratio,omitempty"` // motor revolutions per output shaft revolution, 1 default
+	SPIBus              string         `json:"spi_bus"`
+	ChipSelect          string         `json:"chip_select"`
+	Index               int            `json:"index"`
+	SGThresh            int32          `json:"sg_thresh,omitempty"`
+	HomeRPM             float64        `json:"home_rpm,omitempty"`
+	HomeMode            string         `json:"home_mode,omitempty"`              // "stallguard" (default), "ref_switch" or "limit_switch"
+	HomeSwitchActiveLow bool           `json:"home_switch_active_low,omitempty"` // polarity of the reference switch
+	HomeDirection       string         `json:"home_direction,omitempty"`         // "positive" or "negative" (default)
+	HomeBackoffRevs     float64        `json:"home_backoff_revs,omitempty"`      // back off and re-approach slowly when set
+	HomeSlowRPM         float64        `json:"home_slow_rpm,omitempty"`          // speed of the second approach
+	HomeOffsetRevs      float64        `json:"home_offset_revs,omitempty"`       // passed to ResetZeroPosition once homed
+	CalFactor           float64        `json:"cal_factor,omitempty"`
+	RunCurrent          int32          `json:"run_current,omitempty"`  // 1-32 as a percentage of rsense voltage, 15 default
+	HoldCurrent         int32          `json:"hold_current,omitempty"` // 1-32 as a percentage of rsense voltage, 8 default
+	HoldDelay           int32          `json:"hold_delay,omitempty"`   // 0=instant powerdown, 1-15=delay * 2^18 clocks, 6 default
+	RampParameters      rampParameters `json:"ramp_parameters,omitempty"`
+	MinPositionRevs     *float64       `json:"min_position_revs,omitempty"`
+	MaxPositionRevs     *float64       `json:"max_position_revs,omitempty"`
+	ClampToLimits       bool           `json:"clamp_to_limits,omitempty"`          // clamp out of range targets instead of rejecting them
+	BacklashRevs        float64        `json:"backlash_revs,omitempty"`            // slack between motor and load, in revolutions
+	ModuloRevs          float64        `json:"modulo_revs,omitempty"`              // positions wrap around every modulo_revs revolutions
+	PreservePosition    bool           `json:"preserve_position,omitempty"`        // keep the chip's position unless it has been reset
+	PositionFile        string         `json:"position_file,omitempty"`            // checkpoint the position to this file
+	StallDetection      bool           `json:"stall_detection,omitempty"`          // stop moves with a StallError when the motor stalls
+	RequireHome         bool           `json:"require_home_before_goto,omitempty"` // refuse GoTo/GoFor until homed
+	LimitSwitches       []LimitSwitch  `json:"limit_switches,omitempty"`           // switches on the board that stop the motor
+	StealthChop         *StealthChop   `json:"stealth_chop,omitempty"`             // quiet chopper at low speed, spreadCycle when unset
+	Chopper             Chopper        `json:"chopper,omitempty"`                  // CHOPCONF settings
+	Microsteps          int            `json:"microsteps,omitempty"`               // 1-256 per full step, a power of two, 256 default
+	CoolStep            *CoolStep      `json:"coolstep,omitempty"`                 // current regulation with load, off when unset
+	VCoolThrsRPM        float64        `json:"vcoolthrs_rpm,omitempty"`            // CoolStep and StallGuard act above it, max_rpm/20 default
+	RSenseOhms          float64        `json:"rsense_ohms,omitempty"`              // sense resistor, needed for the currents in amps
+	RunCurrentAmps      float64        `json:"run_current_amps,omitempty"`         // RMS run current, replaces run_current
+	HoldCurrentAmps     float64        `json:"hold_current_amps,omitempty"`        // RMS hold current, half the run current default
+	RatedCurrentAmps    float64        `json:"rated_current_amps,omitempty"`       // motor rating the currents may not exceed
 }
 
 // Model for viam supported analog-devices tmc5072 motor.
@@ -106,7 +135,7 @@ var Model = resource.NewModel("viam", "analog-devices", "tmc5072")
 // Validate ensures all parts of the config are valid.
 func (config *Config) Validate(path string) ([]string, []string, error) {
 	var deps []string
-	if config.Pins.EnablePinLow != "" {
+	if config.Pins.EnablePinLow != "" || len(config.LimitSwitches) > 0 {
 		if config.BoardName == "" {
 			return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "board")
 		}
@@ -127,9 +156,78 @@ func (config *Config) Validate(path string) ([]string, []string, error) {
 	if config.TicksPerRotation <= 0 {
 		return nil, nil, resource.NewConfigValidationFieldRequiredError(path, "ticks_per_rotation")
 	}
+	switch config.HomeMode {
+	case "", HomeModeStallGuard, HomeModeRefSwitch, HomeModeLimitSwitch:
+	default:
+		return nil, nil, errors.Errorf("home_mode must be %q, %q or %q", HomeModeStallGuard, HomeModeRefSwitch, HomeModeLimitSwitch)
+	}
+	switch config.HomeDirection {
+	case "", HomeDirectionPositive, HomeDirectionNegative:
+	default:
+		return nil, nil, errors.Errorf("home_direction must be %q or %q", HomeDirectionPositive, HomeDirectionNegative)
+	}
+	directions := map[string]bool{}
+	for _, sw := range config.LimitSwitches {
+		if err := sw.validate(); err != nil {
+			return nil, nil, err
+		}
+		if directions[sw.Direction] {
+			return nil, nil, errors.Errorf("only one limit switch can be in the %s direction", sw.Direction)
+		}
+		directions[sw.Direction] = true
+	}
+	if config.HomeMode == HomeModeLimitSwitch {
+		homeDirection := config.HomeDirection
+		if homeDirection == "" {
+			homeDirection = HomeDirectionNegative
+		}
+		if !directions[homeDirection] {
+			return nil, nil, errors.Errorf("home_mode %q needs a limit switch in the %s direction", HomeModeLimitSwitch, homeDirection)
+		}
+	}
+	if config.HomeBackoffRevs < 0 {
+		return nil, nil, errors.New("home_backoff_revs must not be negative")
+	}
+	if config.HomeSlowRPM < 0 {
+		return nil, nil, errors.New("home_slow_rpm must not be negative")
+	}
+	if config.GearRatio < 0 {
+		return nil, nil, errors.New("gear_ratio must be positive")
+	}
+	if config.BacklashRevs < 0 {
+		return nil, nil, errors.New("backlash_revs must not be negative")
+	}
+	if config.ModuloRevs < 0 {
+		return nil, nil, errors.New("modulo_revs must not be negative")
+	}
+	if config.ModuloRevs > 0 && (config.MinPositionRevs != nil || config.MaxPositionRevs != nil) {
+		return nil, nil, errors.New("travel limits can't be used with modulo_revs")
+	}
 	if err := config.RampParameters.validate(); err != nil {
 		return nil, nil, err
 	}
+	if config.Microsteps < 0 || config.Microsteps > uSteps || config.Microsteps&(config.Microsteps-1) != 0 {
+		return nil, nil, errors.Errorf("microsteps must be a power of two from 1 to %d, got %d", uSteps, config.Microsteps)
+	}
+	if err := config.CoolStep.validate(); err != nil {
+		return nil, nil, err
+	}
+	if config.VCoolThrsRPM < 0 {
+		return nil, nil, errors.New("vcoolthrs_rpm must not be negative")
+	}
+	if err := config.Chopper.validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := config.validateCurrents(); err != nil {
+		return nil, nil, err
+	}
+	if err := config.StealthChop.validate(); err != nil {
+		return nil, nil, err
+	}
+	if config.MinPositionRevs != nil && config.MaxPositionRevs != nil &&
+		*config.MinPositionRevs >= *config.MaxPositionRevs {
+		return nil, nil, errors.New("min_position_revs must be less than max_position_revs")
+	}
 	return deps, nil, nil
 }
 
@@ -143,29 +241,87 @@ func init() {
 type Motor struct {
 	resource.Named
 	resource.AlwaysRebuild
-	resource.TriviallyCloseable
 	bus         buses.SPI
 	csPin       string
+	chipKey     string
 	index       int
+	board       board.Board // set when limit switches are configured
 	enLowPin    board.GPIOPin
-	stepsPerRev int
-	homeRPM     float64
-	maxRPM      float64
-	maxAcc      float64
-	fClk        float64
-	logger      logging.Logger
-	opMgr       *operation.SingleOperationManager
-	powerPct    float64
-	motorName   string
-	rampParams  rampParameters
+	stepsPerRev float64 // microsteps per output shaft revolution
+	homeRPM     float64 // signed by the homing direction
+	homeSlowRPM float64 // signed by the homing direction
+	homeBackoff float64
+	homeOffset  float64
+	// home with StallGuard, the reference switch or a limit switch, one of the HomeMode values
+	homeMode            string
+	homeSwitchActiveLow bool
+	maxRPM              float64
+	maxAcc              float64
+	fClk                float64
+	logger              logging.Logger
+	opMgr               *operation.SingleOperationManager
+	workers             *utils.StoppableWorkers // tracks the position in the background, nil in tests
+	powerPct            float64
+	motorName           string
+	rampParams          rampParameters
+
+	clampToLimits bool
+	backlash      float64 // revolutions
+	moduloRevs    float64 // 0 on linear axes
+	positionFile  string
+	limitSwitches []*boardSwitch
+	stealthChop   bool
+	coolStep      int32 // CoolStep bits of COOLCONF, 0 when off
+	vHigh         int32 // switchover from stealthChop to spreadCycle
+
+	stallDetection          bool
+	trace                   tracer
+	requireHome             bool           // refuse positioning moves until homed
+	activeBackgroundWorkers sync.WaitGroup // stall monitors of velocity commands and traces
+
+	checkpointMu   sync.Mutex
+	lastCheckpoint *positionCheckpoint
+
+	// serializes the RAMP_STAT reads of readRampStat while stalls are watched for
+	rampStatMu sync.Mutex
+	// held while a limit switch stops the motor and while a command starts it, so that neither
+	// overwrites the other, and by moves checking whether they ended so they see the stop
+	stopMu sync.Mutex
+
+	mu              sync.Mutex
+	target          int64 // target of the most recent GoTo, in steps
+	position        int64 // XACTUAL extended past 32 bits, in steps
+	lastXActual     int32 // XACTUAL when position was last updated
+	lastDirection   int   // direction of the most recent move, 0 until the motor first moves
+	activeSegment   int   // index of the run_sequence segment in progress, -1 when idle
+	minPosition     *float64
+	maxPosition     *float64
+	positionSource  string // where position came from, one of the PositionSource values
+	positionTrusted bool
+	sgThresh        int32 // StallGuard threshold written to COOLCONF, changed by tune_stallguard
+	watchingStalls  bool  // the StallGuard stop is enabled for stall_detection
+	pendingStop     error // ends the current move early, a *StallError or a limit switch stop
+	lastStall       *StallError
+	stallCount      int
+	homed           bool // homed since configured, and the chip not reset since
+	sgFilter        bool // the StallGuard filter is enabled in COOLCONF, for traces
+	// the limit switch being homed against, which stops the motor itself
+	homingSwitch *boardSwitch
+	// the motor running unloaded, recorded by calibrate_load
+	baseline *loadBaseline
+	// the ramp parameters last written to the chip, restored after a fast stop
+	activeRamp rampParameters
 }
 
 // TMC5072 Values.
 const (
 	baseClk = 13200000 // Nominal 13.2mhz internal clock speed
-	uSteps  = 256      // Microsteps per fullstep
+	uSteps  = 256      // Microsteps per fullstep, unless configured lower
 )
 
+// stopTimeout bounds how long an interrupted move may take to decelerate before giving up.
+const stopTimeout = 10 * time.Second
+
 // SNEAKY TRICK ALERT! The TMC5072 always returns the value of the register from the *previous*
 // command, not the current one. For an example, see the top of page 18 of
 // https://www.analog.com/media/en/technical-documentation/data-sheets/TMC5072_datasheet_rev1.26.pdf
@@ -198,6 +354,7 @@ const (
 	vCoolThres = 0x31
 	swMode     = 0x34
 	rampStat   = 0x35
+	xLatch     = 0x36
 )
 
 // TMC5072 ramp modes.
@@ -216,7 +373,20 @@ func newMotor(ctx context.Context, deps resource.Dependencies, c resource.Config
 		return nil, err
 	}
 	bus := buses.NewSpiBus(conf.SPIBus)
-	return makeMotor(ctx, deps, *conf, c.ResourceName(), logger, bus)
+	mot, err := makeMotor(ctx, deps, *conf, c.ResourceName(), logger, bus)
+	if err != nil {
+		return nil, err
+	}
+	m := mot.(*Motor)
+	m.workers = utils.NewBackgroundStoppableWorkers(m.pollPosition)
+	if len(m.limitSwitches) > 0 {
+		ticks, err := m.streamLimitSwitches(m.workers.Context())
+		if err != nil {
+			return nil, multierr.Combine(err, m.Close(ctx))
+		}
+		m.workers.Add(func(ctx context.Context) { m.watchLimitSwitches(ctx, ticks) })
+	}
+	return m, nil
 }
 
 // makeMotor returns a TMC5072 driven motor. It is separate from NewMotor, above, so you can inject
@@ -244,37 +414,99 @@ func makeMotor(ctx context.Context, deps resource.Dependencies, c Config, name r
 		logger.CWarn(ctx, "home_rpm not set: defaulting to 1/4 of max_rpm")
 		c.HomeRPM = c.MaxRPM / 4
 	}
-	c.HomeRPM *= -1
-	stepsPerRev := c.TicksPerRotation * uSteps
+	if c.HomeSlowRPM == 0 {
+		c.HomeSlowRPM = c.HomeRPM / 4
+	}
+	if c.VCoolThrsRPM == 0 {
+		c.VCoolThrsRPM = c.MaxRPM / 20
+	}
+	if c.HomeBackoffRevs > 0 && c.HomeSlowRPM < c.VCoolThrsRPM {
+		// StallGuard is only active above VCOOLTHRS
+		logger.CWarn(ctx, "home_slow_rpm is below vcoolthrs_rpm, StallGuard will not detect the end stop")
+	}
+	if c.HomeDirection != HomeDirectionPositive {
+		c.HomeRPM *= -1
+		c.HomeSlowRPM *= -1
+	}
+	if c.GearRatio == 0 {
+		c.GearRatio = 1
+	}
+	if c.Microsteps == 0 {
+		c.Microsteps = uSteps
+	}
+	// Everything above the chip speaks output shaft revolutions, so the gear ratio is folded into
+	// the step count. It need not be a whole number of steps.
+	stepsPerRev := float64(c.TicksPerRotation*c.Microsteps) * c.GearRatio
 	fClk := baseClk / c.CalFactor
+	if rpmToV(c.MaxRPM, c.MaxRPM, fClk, stepsPerRev) > maxVMax {
+		return nil, errors.Errorf("max_rpm %.1f is beyond the fastest VMAX of the chip at %d microsteps, configure fewer microsteps",
+			c.MaxRPM, c.Microsteps)
+	}
 	rampParams := initRampParameters(c.MaxRPM, c.MaxAcceleration, fClk, stepsPerRev)
 	// in config all ramp parameters are optional, we only override the fields that have been set in config
 	rampParams.mergeRampParameters(c.RampParameters)
+	// the defaults scale with gear_ratio and microsteps too, and the acceleration and V1 registers
+	// are narrower than VMAX
+	if err := rampParams.validate(); err != nil {
+		return nil, errors.Wrapf(err, "max_rpm %.1f and max_acceleration_rpm_per_sec %.1f don't fit the ramp registers of the chip "+
+			"at gear_ratio %g and %d microsteps, lower them or set ramp_parameters", c.MaxRPM, c.MaxAcceleration, c.GearRatio, c.Microsteps)
+	}
 
 	m := &Motor{
 		Named:       name.AsNamed(),
 		bus:         bus,
 		csPin:       c.ChipSelect,
+		chipKey:     chipKey(c.SPIBus, c.ChipSelect),
 		index:       c.Index,
 		stepsPerRev: stepsPerRev,
 		homeRPM:     c.HomeRPM,
-		maxRPM:      c.MaxRPM,
-		maxAcc:      c.MaxAcceleration,
-		fClk:        fClk,
-		logger:      logger,
-		opMgr:       operation.NewSingleOperationManager(),
-		motorName:   name.ShortName(),
-		rampParams:  rampParams,
+		homeSlowRPM: c.HomeSlowRPM,
+		homeBackoff: c.HomeBackoffRevs,
+		homeOffset:  c.HomeOffsetRevs,
+
+		homeMode:            c.HomeMode,
+		homeSwitchActiveLow: c.HomeSwitchActiveLow,
+		maxRPM:              c.MaxRPM,
+		maxAcc:              c.MaxAcceleration,
+		fClk:                fClk,
+		logger:              logger,
+		opMgr:               operation.NewSingleOperationManager(),
+		motorName:           name.ShortName(),
+		rampParams:          rampParams,
+
+		clampToLimits:  c.ClampToLimits,
+		backlash:       c.BacklashRevs,
+		moduloRevs:     c.ModuloRevs,
+		positionFile:   c.PositionFile,
+		stallDetection: c.StallDetection,
+		stealthChop:    c.StealthChop != nil,
+		coolStep:       c.CoolStep.coolConfBits(),
+		requireHome:    c.RequireHome,
+		activeSegment:  -1,
+		minPosition:    c.MinPositionRevs,
+		maxPosition:    c.MaxPositionRevs,
+	}
+
+	if c.SGThresh > sgThreshMax || c.SGThresh < sgThreshMin {
+		logger.CWarnf(ctx, "sg_thresh %d is outside [%d, %d], clamping it", c.SGThresh, sgThreshMin, sgThreshMax)
+		c.SGThresh = min(max(c.SGThresh, sgThreshMin), sgThreshMax)
+	}
+	m.sgThresh = c.SGThresh
+
+	// StallGuard reads nothing useful in stealthChop
+	if c.StallDetection && c.StealthChop != nil {
+		if sc := c.StealthChop.SpreadCycleRPM; sc > 0 && sc < m.maxRPM {
+			logger.CWarnf(ctx, "stall_detection only catches stalls above spreadcycle_rpm (%.1f rpm) with stealth_chop", sc)
+		} else {
+			logger.CWarn(ctx, "stall_detection will not catch stalls, stealth_chop never switches to spreadCycle")
+		}
 	}
 
-	if c.SGThresh > 63 {
-		c.SGThresh = 63
-	} else if c.SGThresh < -64 {
-		c.SGThresh = -64
-	}
-	// The register is a 6 bit signed int
-	if c.SGThresh < 0 {
-		c.SGThresh = int32(64 + math.Abs(float64(c.SGThresh)))
+	// Currents in amps pick VSENSE and set the 1-32 scales below
+	if c.RSenseOhms > 0 {
+		runScale, holdScale, vsense := c.currentScales()
+		c.RunCurrent, c.HoldCurrent = runScale+1, holdScale+1
+		c.Chopper.VSense = vsense
 	}
 
 	// Hold/Run currents are 0-31 (linear scale),
@@ -316,46 +548,73 @@ func makeMotor(ctx context.Context, deps resource.Dependencies, c Config, name r
 		c.HoldDelay = 15
 	}
 
-	coolConfig := c.SGThresh << 16
+	coolConfig := m.coolConfValue(c.SGThresh)
 
 	iCfg := c.HoldDelay<<16 | c.RunCurrent<<8 | c.HoldCurrent
 
 	err := multierr.Combine(
-		m.writeReg(ctx, chopConf, 0x000100C3), // TOFF=3, HSTRT=4, HEND=1, TBL=2, CHM=0 (spreadCycle)
+		// TOFF=3, HSTRT=4, HEND=1, TBL=2, CHM=0 (spreadCycle) and 256 microsteps by default
+		m.writeReg(ctx, chopConf, c.Chopper.chopConfValue()|chopConfMRES(c.Microsteps)),
 		m.writeReg(ctx, iHoldIRun, iCfg),
-		m.writeReg(ctx, coolConf, coolConfig), // Sets just the SGThreshold (for now)
+		m.writeReg(ctx, coolConf, coolConfig), // SGThreshold and CoolStep
 
 		// Set ramp parameters
 		m.applyRampParameters(ctx, m.rampParams),
-		m.writeReg(ctx, vCoolThres, m.rpmToV(m.maxRPM/20)), // Set minimum speed for stall detection and coolstep
+		m.writeReg(ctx, vCoolThres, m.rpmToV(c.VCoolThrsRPM)), // Set minimum speed for stall detection and coolstep
 		m.writeReg(ctx, vMax, int32(*m.rampParams.VMax)),
 
 		m.writeReg(ctx, rampMode, modeVelPos), // Lastly, set velocity mode to force a stop in case chip was left in moving state
-		m.writeReg(ctx, xActual, 0),           // Zero the position
 	)
 	if err != nil {
 		return nil, err
 	}
+	if c.StealthChop != nil {
+		if err := m.setupStealthChop(ctx, c.StealthChop); err != nil {
+			return nil, err
+		}
+	}
+	// Zero the position, or keep it from the last run
+	if err := m.initPosition(ctx, c.PreservePosition); err != nil {
+		return nil, err
+	}
 
-	if c.Pins.EnablePinLow != "" {
+	if c.Pins.EnablePinLow != "" || len(c.LimitSwitches) > 0 {
 		b, err := board.FromDependencies(deps, c.BoardName)
 		if err != nil {
 			return nil, errors.Errorf("%q is not a board", c.BoardName)
 		}
 
-		m.enLowPin, err = b.GPIOPinByName(c.Pins.EnablePinLow)
-		if err != nil {
-			return nil, err
+		if c.Pins.EnablePinLow != "" {
+			m.enLowPin, err = b.GPIOPinByName(c.Pins.EnablePinLow)
+			if err != nil {
+				return nil, err
+			}
+			err = m.Enable(ctx, true)
+			if err != nil {
+				return nil, err
+			}
 		}
-		err = m.Enable(ctx, true)
-		if err != nil {
+		if err := m.setupLimitSwitches(b, c.LimitSwitches); err != nil {
 			return nil, err
 		}
 	}
 
+	m.registerOnChip()
 	return m, nil
 }
 
+// Close releases the motor's channel on the chip.
+func (m *Motor) Close(ctx context.Context) error {
+	if m.workers != nil {
+		m.workers.Stop()
+	}
+	m.opMgr.CancelRunning(ctx)
+	m.stopTrace()
+	m.activeBackgroundWorkers.Wait()
+	m.unregisterFromChip()
+	return nil
+}
+
 func (m *Motor) shiftAddr(addr uint8) uint8 {
 	// Shift register address for motor 2 instead of motor 1
 	if m.index == 2 {
@@ -372,6 +631,17 @@ func (m *Motor) shiftAddr(addr uint8) uint8 {
 }
 
 func (m *Motor) writeReg(ctx context.Context, addr uint8, value int32) error {
+	// Ensure we're not writing in the middle of another component attempting to read (which would
+	// otherwise be non-atomic).
+	globalMu.Lock()
+	defer globalMu.Unlock()
+
+	return m.writeRegLocked(ctx, addr, value)
+}
+
+// writeRegLocked writes a register while the caller holds globalMu, so several writes (possibly to
+// both motors on a chip) can be issued back to back.
+func (m *Motor) writeRegLocked(ctx context.Context, addr uint8, value int32) error {
 	addr = m.shiftAddr(addr)
 
 	var buf [5]byte
@@ -393,11 +663,6 @@ func (m *Motor) writeReg(ctx context.Context, addr uint8, value int32) error {
 
 	m.logger.Debugf("Write to 0x%x: %v", addr, buf[1:])
 
-	// Ensure we're not writing in the middle of another component attempting to read (which would
-	// otherwise be non-atomic).
-	globalMu.Lock()
-	defer globalMu.Unlock()
-
 	_, err = handle.Xfer(ctx, 1000000, m.csPin, 3, buf[:]) // SPI Mode 3, 1mhz
 	if err != nil {
 		return err
@@ -477,13 +742,24 @@ func (m *Motor) getvActual(ctx context.Context) (int32, error) {
 	return rawVel, nil
 }
 
-// Position gives the current motor position.
+// Position gives the current position of the load, which differs from that of the motor by the
+// backlash after moving in the negative direction. On modular axes it is wrapped into
+// [0, modulo_revs).
 func (m *Motor) Position(ctx context.Context, extra map[string]interface{}) (float64, error) {
-	rawPos, err := m.readReg(ctx, xActual)
+	pos, err := m.unwrappedPosition(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return m.wrap(pos), nil
+}
+
+// unwrappedPosition gives the current position of the load without wrapping it on modular axes.
+func (m *Motor) unwrappedPosition(ctx context.Context) (float64, error) {
+	pos, err := m.readPosition(ctx)
 	if err != nil {
 		return 0, errors.Wrapf(err, "error in Position from motor (%s)", m.motorName)
 	}
-	return float64(rawPos) / float64(m.stepsPerRev), nil
+	return m.loadPosition(pos), nil
 }
 
 // Properties returns the status of optional properties on the motor.
@@ -498,16 +774,18 @@ func (m *Motor) Properties(ctx context.Context, extra map[string]interface{}) (m
 func (m *Motor) SetPower(ctx context.Context, powerPct float64, extra map[string]interface{}) error {
 	m.opMgr.CancelRunning(ctx)
 	m.powerPct = powerPct
-	return m.doJog(ctx, powerPct*m.maxRPM)
+	return m.doJog(ctx, powerPct*m.maxRPM, true)
 }
 
 // Jog sets a fixed RPM.
 func (m *Motor) Jog(ctx context.Context, rpm float64) error {
 	m.opMgr.CancelRunning(ctx)
-	return m.doJog(ctx, rpm)
+	return m.doJog(ctx, rpm, true)
 }
 
-func (m *Motor) doJog(ctx context.Context, rpm float64) error {
+// doJog runs the motor at rpm in velocity mode. With enforceLimits, a move towards a configured
+// travel limit runs in positioning mode instead so it stops at the limit.
+func (m *Motor) doJog(ctx context.Context, rpm float64, enforceLimits bool) error {
 	mode := modeVelPos
 	if rpm < 0 {
 		mode = modeVelNeg
@@ -524,17 +802,59 @@ func (m *Motor) doJog(ctx context.Context, rpm float64) error {
 		}
 	}
 
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+	if err := m.checkLimitSwitch(ctx, rpm); err != nil {
+		return err
+	}
+	if rpm != 0 {
+		m.clearStop()
+	}
 	speed := m.rpmToV(math.Abs(rpm))
+	if enforceLimits {
+		limit, limited, err := m.limitAhead(ctx, rpm)
+		if err != nil {
+			return err
+		}
+		if limited {
+			m.setDirection(rpm)
+			m.markMoving(ctx)
+			return m.runToLimit(ctx, speed, limit)
+		}
+	}
+	m.setDirection(rpm)
+	if rpm != 0 {
+		m.markMoving(ctx)
+	}
 	return multierr.Combine(
 		m.writeReg(ctx, rampMode, mode),
 		m.writeReg(ctx, vMax, speed),
 	)
 }
 
+// runToLimit drives the motor towards a travel limit in positioning mode at the given speed.
+func (m *Motor) runToLimit(ctx context.Context, speed int32, limit int64) error {
+	err := multierr.Combine(
+		m.writeReg(ctx, rampMode, modePosition),
+		m.writeReg(ctx, vMax, speed),
+		m.writeReg(ctx, xTarget, int32(limit)),
+	)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.target = limit
+	m.mu.Unlock()
+	return nil
+}
+
 // GoFor turns in the given direction the given number of times at the given speed.
 // Both the RPM and the revolutions can be assigned negative values to move in a backwards direction.
 // Note: if both are negative the motor will spin in the forward direction.
 func (m *Motor) GoFor(ctx context.Context, rpm, rotations float64, extra map[string]interface{}) error {
+	if err := m.checkHomed(ctx); err != nil {
+		return err
+	}
 	warning, err := motor.CheckSpeed(rpm, m.maxRPM)
 	if warning != "" {
 		m.logger.CWarn(ctx, warning)
@@ -543,7 +863,7 @@ func (m *Motor) GoFor(ctx context.Context, rpm, rotations float64, extra map[str
 		return err
 	}
 
-	curPos, err := m.Position(ctx, extra)
+	curPos, err := m.unwrappedPosition(ctx)
 	if err != nil {
 		return errors.Wrapf(err, "error in GoFor from motor (%s)", m.motorName)
 	}
@@ -557,7 +877,7 @@ func (m *Motor) GoFor(ctx context.Context, rpm, rotations float64, extra map[str
 	rpm = math.Abs(rpm)
 
 	target := curPos + rotations
-	return m.GoTo(ctx, rpm, target, extra)
+	return m.goTo(ctx, rpm, target, extra, true)
 }
 
 // Convert rpm to TMC5072 steps/s.
@@ -567,31 +887,47 @@ func (m *Motor) rpmToV(rpm float64) int32 {
 	}
 	// Time constant for velocities in TMC5072
 	tConst := m.fClk / math.Pow(2, 24)
-	speed := rpm / 60 * float64(m.stepsPerRev) / tConst
+	speed := rpm / 60 * m.stepsPerRev / tConst
 	return int32(speed)
 }
 
+// vToRPM converts a TMC5072 velocity to rpm.
+func (m *Motor) vToRPM(v int32) float64 {
+	tConst := m.fClk / math.Pow(2, 24)
+	return float64(v) * tConst / m.stepsPerRev * 60
+}
+
+// revsToSteps converts output shaft revolutions to TMC5072 microsteps.
+func (m *Motor) revsToSteps(revs float64) int64 {
+	return int64(revs * m.stepsPerRev)
+}
+
+// stepsToRevs converts TMC5072 microsteps to output shaft revolutions.
+func (m *Motor) stepsToRevs(steps int64) float64 {
+	return float64(steps) / m.stepsPerRev
+}
+
 // rpmsToA converts rpm/s to TMC5072 steps/taConst^2.
-func rpmsToA(acc, fClk float64, stepsPerRev int) int32 {
+func rpmsToA(acc, fClk, stepsPerRev float64) int32 {
 	// Time constant for accelerations in TMC5072
 	taConst := math.Pow(2, 41) / math.Pow(fClk, 2)
-	rawMaxAcc := acc / 60 * float64(stepsPerRev) * taConst
+	rawMaxAcc := acc / 60 * stepsPerRev * taConst
 	return int32(rawMaxAcc)
 }
 
 // rpmToV converts rpm to TMC5072 steps/s.
-func rpmToV(rpm, maxRPM, fClk float64, stepsPerRev int) int32 {
+func rpmToV(rpm, maxRPM, fClk, stepsPerRev float64) int32 {
 	if rpm > maxRPM {
 		rpm = maxRPM
 	}
 	// Time constant for velocities in TMC5072
 	tConst := fClk / math.Pow(2, 24)
-	speed := rpm / 60 * float64(stepsPerRev) / tConst
+	speed := rpm / 60 * stepsPerRev / tConst
 	return int32(speed)
 }
 
 // initRampParameters initializes a rampParameters struct with default values.
-func initRampParameters(maxRPM, maxAcc, fClk float64, stepsPerRev int) rampParameters {
+func initRampParameters(maxRPM, maxAcc, fClk, stepsPerRev float64) rampParameters {
 	rawMaxAcc := uint32(rpmsToA(maxAcc, fClk, stepsPerRev))
 	vStart := uint32(1)
 	vStop := uint32(10)
@@ -722,7 +1058,7 @@ func (m *Motor) applyRampParameters(ctx context.Context, params rampParameters)
 		return errors.New("ramp parameter field 'd_max' is not set")
 	}
 
-	return multierr.Combine(
+	err := multierr.Combine(
 		m.writeReg(ctx, a1, int32(*params.A1)),
 		m.writeReg(ctx, aMax, int32(*params.AMax)),
 		m.writeReg(ctx, d1, int32(*params.D1)),
@@ -731,31 +1067,82 @@ func (m *Motor) applyRampParameters(ctx context.Context, params rampParameters)
 		m.writeReg(ctx, vStop, int32(*params.VStop)),
 		m.writeReg(ctx, v1, int32(*params.V1)),
 	)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.activeRamp = params
+	m.mu.Unlock()
+	return nil
 }
 
 // GoTo moves to the specified position in terms of (provided in revolutions from home/zero),
 // at a specific speed. Regardless of the directionality of the RPM this function will move the
-// motor towards the specified target.
+// motor towards the specified target. If the move is cancelled or replaced before the target is
+// reached, the motor decelerates to a stop and the returned error reports where it came to rest.
+// Passing "wait": false in extra returns as soon as the target has been written; use the
+// move_status and wait_for_move DoCommands to follow the move from there. On modular axes the
+// motor takes the shortest way round to the wrapped target unless "direction" in extra is "cw"
+// or "ccw". With require_home_before_goto it fails until the motor has been homed.
 func (m *Motor) GoTo(ctx context.Context, rpm, positionRevolutions float64, extra map[string]interface{}) error {
+	if err := m.checkHomed(ctx); err != nil {
+		return err
+	}
+	if m.moduloRevs != 0 {
+		direction, err := parseDirection(extra)
+		if err != nil {
+			return err
+		}
+		curPos, err := m.unwrappedPosition(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "error in GoTo from motor (%s)", m.motorName)
+		}
+		positionRevolutions = m.modularTarget(curPos, positionRevolutions, direction)
+	}
+	return m.goTo(ctx, rpm, positionRevolutions, extra, true)
+}
+
+// goTo moves to an unwrapped position, see GoTo. Without enforceLimits the travel limits are not
+// checked, for the moves of homing and probing that have to reach past them.
+func (m *Motor) goTo(ctx context.Context, rpm, positionRevolutions float64, extra map[string]interface{}, enforceLimits bool) error {
 	ctx, done := m.opMgr.New(ctx)
-	defer done()
+	running, err := m.doGoTo(ctx, rpm, positionRevolutions, extra, enforceLimits)
+	done()
+	if err != nil || !running || !m.stallDetection {
+		return err
+	}
+	// Nothing waits on the move, so it is watched for stalls in the background like a velocity
+	// command, once its own operation has ended.
+	monitorCtx, monitorDone := m.opMgr.New(context.Background())
+	m.activeBackgroundWorkers.Add(1)
+	go m.monitorStalls(monitorCtx, monitorDone, true)
+	return nil
+}
 
+// doGoTo starts the move of goTo and waits for it to finish, unless the wait extra is false, in
+// which case it returns true with the motor still running.
+func (m *Motor) doGoTo(ctx context.Context, rpm, positionRevolutions float64, extra map[string]interface{}, enforceLimits bool,
+) (bool, error) {
 	// Make a copy of configured ramp parameters
 	rampParams := m.rampParams
+	wait := true
 
 	// Merge with extra ramp_parameters if present
 	if extra != nil {
 		if rampParamsRaw, ok := extra["ramp_parameters"]; ok {
 			extraRampParams, err := parseRampParametersFromExtra(rampParamsRaw)
 			if err != nil {
-				return err
+				return false, err
 			}
 			rampParams.mergeRampParameters(*extraRampParams)
 		}
+		if waitRaw, ok := extra[Wait]; ok {
+			if wait, ok = waitRaw.(bool); !ok {
+				return false, errors.Errorf("%s must be a boolean, got %T", Wait, waitRaw)
+			}
+		}
 	}
 
-	positionRevolutions *= float64(m.stepsPerRev)
-
 	warning, err := motor.CheckSpeed(rpm, m.maxRPM)
 	if warning != "" {
 		m.logger.CWarn(ctx, warning)
@@ -764,31 +1151,246 @@ func (m *Motor) GoTo(ctx context.Context, rpm, positionRevolutions float64, extr
 		m.logger.CError(ctx, err)
 	}
 
+	if err := m.startMove(ctx, rpm, positionRevolutions, rampParams, enforceLimits); err != nil {
+		return false, errors.Wrapf(err, "error in GoTo from motor (%s)", m.motorName)
+	}
+	if !wait {
+		return true, nil
+	}
+	return false, m.finishMove(ctx, rampParams)
+}
+
+// startMove puts the ramp generator in positioning mode and writes the ramp parameters, speed and
+// target for a move to positionRevolutions. With enforceLimits the target is checked against the
+// travel limits first.
+func (m *Motor) startMove(ctx context.Context, rpm, positionRevolutions float64, rampParams rampParameters, enforceLimits bool) error {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+	var err error
+	if enforceLimits {
+		if positionRevolutions, err = m.checkLimits(ctx, positionRevolutions); err != nil {
+			return err
+		}
+	}
+	// XTARGET is the low 32 bits of the extended target, the position only bounds the length of
+	// the move. The last known one is good enough for that, but taking up backlash depends on
+	// exactly where the motor is.
+	pos := m.knownPosition()
+	if m.backlash != 0 {
+		if pos, err = m.readPosition(ctx); err != nil {
+			return err
+		}
+	}
+	target, direction := m.motorTarget(positionRevolutions, pos)
+	chipTarget, err := m.chipTarget(target, pos)
+	if err != nil {
+		return err
+	}
+	if err := m.checkLimitSwitch(ctx, float64(target-pos)); err != nil {
+		return err
+	}
+	if err := m.watchForStalls(ctx); err != nil {
+		return err
+	}
+	m.markMoving(ctx)
 	err = multierr.Combine(
 		m.writeReg(ctx, rampMode, modePosition),
 		// Apply ramp parameters
 		m.applyRampParameters(ctx, rampParams),
 		// Apply vMax and target
 		m.writeReg(ctx, vMax, m.rpmToV(math.Abs(rpm))),
-		m.writeReg(ctx, xTarget, int32(positionRevolutions)),
+		m.writeReg(ctx, xTarget, chipTarget),
 	)
 	if err != nil {
-		return errors.Wrapf(err, "error in GoTo from motor (%s)", m.motorName)
+		return err
 	}
+	m.setDirection(direction)
+	m.mu.Lock()
+	m.target = target
+	m.mu.Unlock()
+	return nil
+}
 
+// finishMove waits for the move started by startMove to reach its target. If ctx is cancelled first
+// the motor is brought to a controlled stop. With stall_detection a stall ends the move early with
+// a *StallError.
+func (m *Motor) finishMove(ctx context.Context, rampParams rampParameters) error {
+	defer func() {
+		if err := m.stopWatchingStalls(context.WithoutCancel(ctx)); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
 	// look for the position reached flag in  the stat register, looking for vzero could lead to
 	// premature stops (the velocity can remain null for a while depending on the configuration)
-	return m.opMgr.WaitForSuccess(
-		ctx,
-		time.Millisecond*10,
-		func(ctx context.Context) (bool, error) {
-			stat, err := m.readReg(ctx, rampStat)
-			if err != nil {
-				return false, errors.Wrapf(err, "error in checking position reached (%s)", m.motorName)
+	err := m.opMgr.WaitForSuccess(ctx, time.Millisecond*10, m.positionReached)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up on the move or another operation replaced it. Either way the chip would
+		// otherwise keep driving towards the old target, so bring it to a controlled stop first.
+		pos, stopErr := m.decelerateToStop(context.WithoutCancel(ctx), rampParams)
+		if stopErr != nil {
+			return multierr.Combine(err, stopErr)
+		}
+		return errors.Wrapf(err, "move on motor (%s) interrupted, stopped at %.4f revolutions", m.motorName, pos)
+	}
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	target := m.target
+	m.mu.Unlock()
+	m.saveCheckpoint(ctx, target, true)
+	return nil
+}
+
+// positionReached returns true once the ramp generator has set the position reached flag, or the
+// error of a stall or limit switch that stopped the move on the way.
+func (m *Motor) positionReached(ctx context.Context) (bool, error) {
+	// a limit switch stop ends at rest on a new target, only seen as reached before its error is left
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+	stat, err := m.readRampStat(ctx)
+	if err != nil {
+		return false, errors.Wrapf(err, "error in checking position reached (%s)", m.motorName)
+	}
+	if err := m.stopError(); err != nil {
+		return false, err
+	}
+	return (stat>>9)&0x1 == 1, nil
+}
+
+// waitForMove blocks until the current move reaches its target. A zero timeout waits indefinitely.
+// Timing out or cancelling the wait does not stop the motor.
+func (m *Motor) waitForMove(ctx context.Context, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// Poll without the operation manager, taking an operation would cancel the move being waited on.
+	// A stall or limit switch stop fails the wait, whether or not anything else saw it first.
+	for {
+		m.stopMu.Lock()
+		stat, err := m.readRampStat(ctx)
+		stopErr := m.stopError()
+		m.stopMu.Unlock()
+		if err != nil {
+			return errors.Wrapf(err, "error in checking position reached (%s)", m.motorName)
+		}
+		if stopErr != nil {
+			return stopErr
+		}
+		if (stat>>9)&0x1 == 1 {
+			return nil
+		}
+		if !utils.SelectContextOrWait(ctx, time.Millisecond*10) {
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return errors.Errorf("timed out after %v waiting for motor (%s) to reach its target", timeout, m.motorName)
 			}
-			return (stat>>9)&0x1 == 1, nil
-		},
+			return ctx.Err()
+		}
+	}
+}
+
+// moveStatus reports the progress of the current (or last) positioning move.
+func (m *Motor) moveStatus(ctx context.Context) (map[string]interface{}, error) {
+	pos, err := m.readPosition(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in move_status from motor (%s)", m.motorName)
+	}
+	stat, err := m.readRampStat(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in move_status from motor (%s)", m.motorName)
+	}
+	m.mu.Lock()
+	target := m.target
+	activeSegment := m.activeSegment
+	// RAMP_STAT forgets a stall once read, and a stopped move was retargeted to where it stopped
+	stopErr := m.pendingStop
+	m.mu.Unlock()
+	var stallErr *StallError
+
+	status := map[string]interface{}{
+		"target":    m.wrap(m.loadPosition(target)),
+		"position":  m.wrap(m.loadPosition(pos)),
+		"remaining": m.stepsToRevs(target - pos),
+		"reached":   (stat>>9)&0x1 == 1 && stopErr == nil,
+		"stalled":   errors.As(stopErr, &stallErr),
+	}
+	if activeSegment >= 0 {
+		status["segment"] = activeSegment
+	}
+	// DRV_STATUS is only read for the fields that are configured
+	m.mu.Lock()
+	baseline := m.baseline
+	m.mu.Unlock()
+	if m.coolStep == 0 && baseline == nil {
+		return status, nil
+	}
+	sg, cs, rpm, err := m.readLoad(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error in move_status from motor (%s)", m.motorName)
+	}
+	if m.coolStep != 0 {
+		status["cs_actual"] = cs
+	}
+	if baseline != nil && rpm != 0 && baseline.matches(rpm) {
+		status["load_pct"] = baseline.loadPct(sg, cs)
+	}
+	return status, nil
+}
+
+// decelerateToStop ends a positioning move early, stopping the same way a move normally ends, and
+// returns where the motor came to rest in revolutions.
+func (m *Motor) decelerateToStop(ctx context.Context, rampParams rampParameters) (float64, error) {
+	rawPos, err := m.decelerate(ctx, *rampParams.DMax, *rampParams.D1, rampParams)
+	if err != nil {
+		return 0, err
+	}
+	return m.wrap(m.loadPosition(m.extendPosition(rawPos))), nil
+}
+
+// decelerate stops the motor. With VSTART and VMAX at zero the ramp generator decelerates using
+// AMAX and A1, so those are temporarily loaded with the given accelerations. Once the motor reports
+// vzero the target is moved to where it came to rest, rampParams are restored and XACTUAL is
+// returned.
+func (m *Motor) decelerate(ctx context.Context, accel, accel1 uint32, rampParams rampParameters) (int32, error) {
+	err := multierr.Combine(
+		m.writeReg(ctx, aMax, int32(accel)),
+		m.writeReg(ctx, a1, int32(accel1)),
+		m.writeReg(ctx, vStart, 0),
+		m.writeReg(ctx, vMax, 0),
 	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error stopping motor (%s)", m.motorName)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, stopTimeout)
+	defer cancel()
+	for {
+		stopped, err := m.IsStopped(ctx)
+		if err != nil {
+			return 0, err
+		}
+		if stopped {
+			break
+		}
+		if !utils.SelectContextOrWait(ctx, 10*time.Millisecond) {
+			return 0, errors.Errorf("timed out waiting for motor (%s) to decelerate to a stop", m.motorName)
+		}
+	}
+
+	rawPos, err := m.readReg(ctx, xActual)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error reading stop position of motor (%s)", m.motorName)
+	}
+	err = multierr.Combine(
+		m.writeReg(ctx, xTarget, rawPos),
+		m.applyRampParameters(ctx, rampParams),
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error restoring ramp parameters of motor (%s)", m.motorName)
+	}
+	return rawPos, nil
 }
 
 // SetRPM instructs the motor to move at the specified RPM indefinitely.
@@ -824,7 +1426,42 @@ func (m *Motor) SetRPM(ctx context.Context, rpm float64, extra map[string]interf
 		}
 	}
 
+	if err := m.startVelocity(ctx, rpm, mode, rampParams); err != nil || !m.stallDetection || rpm == 0 {
+		return err
+	}
+	monitorCtx, done := m.opMgr.New(context.Background())
+	m.activeBackgroundWorkers.Add(1)
+	go m.monitorStalls(monitorCtx, done, false)
+	return nil
+}
+
+// startVelocity starts the velocity command of SetRPM, waiting for a limit switch stop in progress
+// to finish first.
+func (m *Motor) startVelocity(ctx context.Context, rpm float64, mode int32, rampParams rampParameters) error {
+	m.stopMu.Lock()
+	defer m.stopMu.Unlock()
+	if err := m.checkLimitSwitch(ctx, rpm); err != nil {
+		return err
+	}
 	speed := m.rpmToV(math.Abs(rpm))
+	limit, limited, err := m.limitAhead(ctx, rpm)
+	if err != nil {
+		return err
+	}
+	m.setDirection(rpm)
+	if rpm != 0 {
+		if err := m.watchForStalls(ctx); err != nil {
+			return err
+		}
+		m.markMoving(ctx)
+	}
+	if limited {
+		// Run towards the travel limit in positioning mode so the motor stops there
+		return multierr.Combine(
+			m.applyRampParameters(ctx, rampParams),
+			m.runToLimit(ctx, speed, limit),
+		)
+	}
 	return multierr.Combine(
 		m.writeReg(ctx, rampMode, mode),
 		// Apply ramp parameters
@@ -845,7 +1482,7 @@ func (m *Motor) IsPowered(ctx context.Context, extra map[string]interface{}) (bo
 
 // IsStopped returns true if the motor is NOT moving.
 func (m *Motor) IsStopped(ctx context.Context) (bool, error) {
-	stat, err := m.readReg(ctx, rampStat)
+	stat, err := m.readRampStat(ctx)
 	if err != nil {
 		return false, errors.Wrapf(err, "error in IsStopped from motor (%s)", m.motorName)
 	}
@@ -855,7 +1492,7 @@ func (m *Motor) IsStopped(ctx context.Context) (bool, error) {
 
 // AtVelocity returns true if the motor has reached the requested velocity.
 func (m *Motor) AtVelocity(ctx context.Context) (bool, error) {
-	stat, err := m.readReg(ctx, rampStat)
+	stat, err := m.readRampStat(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -874,7 +1511,7 @@ func (m *Motor) Enable(ctx context.Context, turnOn bool) error {
 // Stop stops the motor.
 func (m *Motor) Stop(ctx context.Context, extra map[string]interface{}) error {
 	m.opMgr.CancelRunning(ctx)
-	return m.doJog(ctx, 0)
+	return m.doJog(ctx, 0, false)
 }
 
 // IsMoving returns true if the motor is currently moving.
@@ -883,28 +1520,99 @@ func (m *Motor) IsMoving(ctx context.Context) (bool, error) {
 	return !stop, err
 }
 
-// home homes the motor using stallguard.
+// home homes the motor using stallguard, the reference switch or a limit switch on the board.
 func (m *Motor) home(ctx context.Context) error {
-	err := m.goTillStop(ctx, m.homeRPM, nil)
+	overshoot, err := m.approachEndStop(ctx, m.homeRPM)
 	if err != nil {
 		return err
 	}
+
+	if m.homeBackoff > 0 {
+		// StallGuard is more repeatable at low speed, so back off and come back slowly
+		pos, err := m.unwrappedPosition(ctx)
+		if err != nil {
+			return err
+		}
+		backoff := m.homeBackoff
+		if m.homeRPM > 0 {
+			backoff *= -1
+		}
+		// the travel limits are relative to the home position, which isn't known yet
+		if err := m.goTo(ctx, math.Abs(m.homeRPM), pos+backoff, nil, false); err != nil {
+			return errors.Wrapf(err, "error backing off the end stop while homing motor (%s)", m.motorName)
+		}
+		if overshoot, err = m.approachEndStop(ctx, m.homeSlowRPM); err != nil {
+			return err
+		}
+	}
+
+	// Zero where the end stop triggered rather than where the motor came to rest
+	if err := m.ResetZeroPosition(ctx, m.homeOffset-m.stepsToRevs(overshoot), nil); err != nil {
+		return err
+	}
+	return m.markHomed(ctx)
+}
+
+// approachEndStop runs the motor at rpm until it is stopped at the end stop, by StallGuard or by
+// a switch following home_mode, and returns how far past the end stop it came to rest, in steps.
+func (m *Motor) approachEndStop(ctx context.Context, rpm float64) (int64, error) {
+	return m.approach(ctx, rpm, m.homeMode, false)
+}
+
+// approach runs the motor at rpm until StallGuard, the reference switch or a limit switch stops
+// it, following mode, and returns how far past the trigger point it came to rest, in steps. With
+// enforceLimits the motor stops at the travel limit in its way instead, if it gets there first,
+// and errTravelLimitReached is returned.
+func (m *Motor) approach(ctx context.Context, rpm float64, mode string, enforceLimits bool) (int64, error) {
+	var limit *int64
+	if enforceLimits {
+		target, limited, err := m.limitAhead(ctx, rpm)
+		if err != nil {
+			return 0, err
+		}
+		if limited {
+			limit = &target
+		}
+	}
+	// the end stop is meant to stop the motor, it is not a stall
+	if err := m.stopWatchingStalls(ctx); err != nil {
+		return 0, err
+	}
+	// StallGuard only works in spreadCycle
+	if err := m.forceSpreadCycle(ctx, true); err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := m.forceSpreadCycle(context.WithoutCancel(ctx), false); err != nil {
+			m.logger.CError(ctx, err)
+		}
+	}()
+	switch mode {
+	case HomeModeRefSwitch:
+		return m.approachRefSwitch(ctx, rpm, limit)
+	case HomeModeLimitSwitch:
+		return m.approachLimitSwitch(ctx, rpm, limit)
+	}
+	err := m.goTillStop(ctx, rpm, limit, nil)
+	if err != nil {
+		return 0, err
+	}
 	for {
 		stopped, err := m.IsStopped(ctx)
 		if err != nil {
-			return err
+			return 0, err
 		}
 		if stopped {
-			break
+			return 0, nil
 		}
 	}
-
-	return m.ResetZeroPosition(ctx, 0, nil)
 }
 
 // goTillStop enables StallGuard detection, then moves in the direction/speed given until resistance (endstop) is detected.
-func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx context.Context) bool) error {
-	if err := m.Jog(ctx, rpm); err != nil {
+// Homing has to reach the end stop, so the travel limits are only enforced when a limit is given.
+func (m *Motor) goTillStop(ctx context.Context, rpm float64, limit *int64, stopFunc func(ctx context.Context) bool) error {
+	m.opMgr.CancelRunning(ctx)
+	if err := m.doJog(ctx, rpm, limit != nil); err != nil {
 		return err
 	}
 	ctx, done := m.opMgr.New(ctx)
@@ -914,7 +1622,7 @@ func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx c
 	defer func() {
 		if err := multierr.Combine(
 			m.writeReg(ctx, swMode, 0x000),
-			m.doJog(ctx, 0),
+			m.doJog(ctx, 0, false),
 		); err != nil {
 			m.logger.CError(ctx, err)
 		}
@@ -931,6 +1639,11 @@ func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx c
 			return nil
 		}
 
+		// a limit close by can be reached before the motor is up to speed
+		if err := m.checkReachedLimit(ctx, limit); err != nil {
+			return err
+		}
+
 		ready, err := m.AtVelocity(ctx)
 		if err != nil {
 			return err
@@ -947,7 +1660,7 @@ func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx c
 	}
 
 	// Now enable stallguard
-	if err := m.writeReg(ctx, swMode, 0x400); err != nil {
+	if err := m.writeReg(ctx, swMode, swSGStop); err != nil {
 		return err
 	}
 
@@ -967,6 +1680,9 @@ func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx c
 			return err
 		}
 		if stopped {
+			if err := m.checkReachedLimit(ctx, limit); err != nil {
+				return err
+			}
 			break
 		}
 
@@ -980,7 +1696,7 @@ func (m *Motor) goTillStop(ctx context.Context, rpm float64, stopFunc func(ctx c
 }
 
 // ResetZeroPosition sets the current position of the motor specified by the request
-// (adjusted by a given offset) to be its new zero position.
+// (adjusted by a given offset) to be its new zero position. The motor is no longer homed.
 func (m *Motor) ResetZeroPosition(ctx context.Context, offset float64, extra map[string]interface{}) error {
 	on, _, err := m.IsPowered(ctx, extra)
 	if err != nil {
@@ -988,20 +1704,64 @@ func (m *Motor) ResetZeroPosition(ctx context.Context, offset float64, extra map
 	} else if on {
 		return errors.Errorf("can't zero motor (%s) while moving", m.motorName)
 	}
-	return multierr.Combine(
+	// the new zero is in load coordinates, so keep the motor offset from it by any backlash
+	zero := m.revsToSteps(-offset - m.backlashOffset())
+	err = multierr.Combine(
 		m.writeReg(ctx, rampMode, modeHold),
-		m.writeReg(ctx, xTarget, int32(-1*offset*float64(m.stepsPerRev))),
-		m.writeReg(ctx, xActual, int32(-1*offset*float64(m.stepsPerRev))),
+		m.writeReg(ctx, xTarget, int32(zero)),
+		m.writeReg(ctx, xActual, int32(zero)),
 	)
+	if err != nil {
+		return err
+	}
+	m.setPosition(zero)
+	m.setPositionSource(PositionSourceZeroed, true)
+	m.setHomed(false)
+	m.saveCheckpoint(ctx, zero, true)
+	return nil
 }
 
 // DoCommand() related constants.
 const (
-	Command    = "command"
-	Home       = "home"
-	Jog        = "jog"
-	RPMVal     = "rpm"
-	GetVActual = "get_v_actual"
+	Command         = "command"
+	Home            = "home"
+	Jog             = "jog"
+	RPMVal          = "rpm"
+	GetVActual      = "get_v_actual"
+	MoveStatus      = "move_status"
+	WaitForMove     = "wait_for_move"
+	TimeoutMs       = "timeout_ms"
+	RunSequence     = "run_sequence"
+	Segments        = "segments"
+	CoordinatedGoTo = "coordinated_go_to"
+	Positions       = "positions"
+	Wait            = "wait"      // extra key for GoTo and GoFor
+	Direction       = "direction" // extra key for GoTo on modular axes
+	PositionStatus  = "position_status"
+	MeasureTravel   = "measure_travel"
+	SetLimits       = "set_limits"
+	MarginRevs      = "margin_revs"
+	TuneStallGuard  = "tune_stallguard"
+	StallStatus     = "stall_status"
+	GetHomeState    = "get_home_state"
+	Probe           = "probe"
+	RetractRevs     = "retract_revs"
+	Trigger         = "trigger"
+	StartTrace      = "start_trace"
+	StopTrace       = "stop_trace"
+	GetTrace        = "get_trace"
+	IntervalMs      = "interval_ms"
+	MaxSamples      = "max_samples"
+	SFilt           = "sfilt"
+	Apply           = "apply"
+	GetLoad         = "get_load"
+	CalibrateLoad   = "calibrate_load"
+)
+
+// Values of home_direction.
+const (
+	HomeDirectionPositive = "positive"
+	HomeDirectionNegative = "negative"
 )
 
 // DoCommand executes additional commands beyond the Motor{} interface.
@@ -1029,6 +1789,133 @@ func (m *Motor) DoCommand(ctx context.Context, cmd map[string]interface{}) (map[
 			return nil, err
 		}
 		return map[string]interface{}{"v_actual": vActualVal}, nil
+	case MoveStatus:
+		return m.moveStatus(ctx)
+	case PositionStatus:
+		return m.positionStatus(ctx)
+	case StallStatus:
+		return m.stallStatus(), nil
+	case GetLoad:
+		return m.getLoad(ctx)
+	case CalibrateLoad:
+		return m.calibrateLoad(ctx)
+	case Probe:
+		rpm, ok := cmd[RPMVal].(float64)
+		if !ok || rpm == 0 {
+			return nil, errors.Errorf("need a non-zero floating point %s value for %s", RPMVal, Probe)
+		}
+		var retract float64
+		if retractRaw, ok := cmd[RetractRevs]; ok {
+			if retract, ok = retractRaw.(float64); !ok || retract < 0 {
+				return nil, errors.Errorf("%s must be a non-negative number", RetractRevs)
+			}
+		}
+		trigger := m.homeMode
+		if triggerRaw, ok := cmd[Trigger]; ok {
+			switch triggerRaw {
+			case HomeModeStallGuard, HomeModeRefSwitch, HomeModeLimitSwitch:
+				trigger = triggerRaw.(string)
+			default:
+				return nil, errors.Errorf("%s must be %q, %q or %q", Trigger, HomeModeStallGuard, HomeModeRefSwitch,
+					HomeModeLimitSwitch)
+			}
+		}
+		return m.probe(ctx, rpm, retract, trigger)
+	case StartTrace:
+		interval := defaultTraceInterval
+		if intervalRaw, ok := cmd[IntervalMs]; ok {
+			intervalMs, ok := intervalRaw.(float64)
+			if !ok || intervalMs <= 0 {
+				return nil, errors.Errorf("%s must be a positive number", IntervalMs)
+			}
+			interval = time.Duration(intervalMs * float64(time.Millisecond))
+		}
+		maxSamples := defaultTraceSamples
+		if maxSamplesRaw, ok := cmd[MaxSamples]; ok {
+			maxSamplesVal, ok := maxSamplesRaw.(float64)
+			if !ok || maxSamplesVal < 1 {
+				return nil, errors.Errorf("%s must be a positive number", MaxSamples)
+			}
+			maxSamples = int(maxSamplesVal)
+		}
+		sfilt := false
+		if sfiltRaw, ok := cmd[SFilt]; ok {
+			if sfilt, ok = sfiltRaw.(bool); !ok {
+				return nil, errors.Errorf("%s must be a boolean, got %T", SFilt, sfiltRaw)
+			}
+		}
+		return nil, m.startTrace(ctx, interval, maxSamples, sfilt)
+	case StopTrace:
+		m.stopTrace()
+		return m.traceResult(), nil
+	case GetTrace:
+		return m.traceResult(), nil
+	case GetHomeState:
+		homed, err := m.homeState(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"homed": homed}, nil
+	case MeasureTravel:
+		setLimits := false
+		if setLimitsRaw, ok := cmd[SetLimits]; ok {
+			if setLimits, ok = setLimitsRaw.(bool); !ok {
+				return nil, errors.Errorf("%s must be a boolean, got %T", SetLimits, setLimitsRaw)
+			}
+		}
+		var margin float64
+		if marginRaw, ok := cmd[MarginRevs]; ok {
+			if margin, ok = marginRaw.(float64); !ok || margin < 0 {
+				return nil, errors.Errorf("%s must be a non-negative number", MarginRevs)
+			}
+		}
+		return m.measureTravel(ctx, setLimits, margin)
+	case TuneStallGuard:
+		rpm := m.homeRPM
+		if rpmRaw, ok := cmd[RPMVal]; ok {
+			if rpm, ok = rpmRaw.(float64); !ok || rpm == 0 {
+				return nil, errors.Errorf("%s must be a non-zero number", RPMVal)
+			}
+		}
+		apply := false
+		if applyRaw, ok := cmd[Apply]; ok {
+			if apply, ok = applyRaw.(bool); !ok {
+				return nil, errors.Errorf("%s must be a boolean, got %T", Apply, applyRaw)
+			}
+		}
+		return m.tuneStallGuard(ctx, rpm, apply)
+	case WaitForMove:
+		var timeout time.Duration
+		if timeoutRaw, ok := cmd[TimeoutMs]; ok {
+			timeoutMs, ok := timeoutRaw.(float64)
+			if !ok {
+				return nil, errors.Errorf("%s value must be floating point", TimeoutMs)
+			}
+			timeout = time.Duration(timeoutMs * float64(time.Millisecond))
+		}
+		if err := m.waitForMove(ctx, timeout); err != nil {
+			return nil, err
+		}
+		return m.moveStatus(ctx)
+	case RunSequence:
+		segments, err := parseSequence(cmd[Segments])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.runSequence(ctx, segments); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"segments_completed": len(segments)}, nil
+	case CoordinatedGoTo:
+		rpm, ok := cmd[RPMVal].(float64)
+		if !ok {
+			return nil, errors.Errorf("need floating point %s value for %s", RPMVal, CoordinatedGoTo)
+		}
+		positions, err := parseCoordinatedPositions(cmd[Positions])
+		if err != nil {
+			return nil, err
+		}
+		return nil, m.coordinatedGoTo(ctx, rpm, positions)
 	default:
 		return nil, errors.Errorf("no such command: %s", name)
 	}
@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"go.viam.com/rdk/components/board/genericlinux/buses"
 	"go.viam.com/rdk/components/motor"
@@ -62,6 +63,14 @@ func (h *fakeSpiHandle) AddExpectedRx(expects, sends [][]byte) {
 	h.rx = append(h.rx, sends...)
 }
 
+// transferred returns how many transfers have been made, for tests that drive the motor from
+// several goroutines. Every transfer happens under globalMu.
+func (h *fakeSpiHandle) transferred() int {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	return h.i
+}
+
 func (h *fakeSpiHandle) ExpectDone() {
 	// Assert that all expected data was transmitted
 	test.That(h.tb, h.i, test.ShouldEqual, len(h.tx))
@@ -79,6 +88,133 @@ func newFakeSpi(tb testing.TB) (*fakeSpiHandle, buses.SPI) {
 
 const maxRpm = 500
 
+// testMotorSetupTx are the register writes (and the GSTAT read) makeMotor issues for
+// testMotorConfig.
+var testMotorSetupTx = [][]byte{
+	{236, 0, 1, 0, 195},
+	{176, 0, 6, 15, 8},
+	{237, 0, 0, 0, 0},
+	{164, 0, 0, 21, 8},
+	{166, 0, 0, 21, 8},
+	{170, 0, 0, 21, 8},
+	{168, 0, 0, 21, 8},
+	{163, 0, 0, 0, 1},
+	{171, 0, 0, 0, 10},
+	{165, 0, 2, 17, 149},
+	{177, 0, 0, 105, 234},
+	{167, 0, 0, 0, 0},
+	{160, 0, 0, 0, 1},
+	{1, 0, 0, 0, 0}, // GSTAT, no reset
+	{1, 0, 0, 0, 0},
+	{161, 0, 0, 0, 0},
+}
+
+func testMotorConfig() Config {
+	return Config{
+		SPIBus:           "main",
+		ChipSelect:       "40",
+		Index:            1,
+		CalFactor:        1.0,
+		MaxAcceleration:  500,
+		MaxRPM:           maxRpm,
+		TicksPerRotation: 200,
+	}
+}
+
+// testMotorOption adjusts how makeTestMotor builds a motor.
+type testMotorOption func(*testMotorSetup)
+
+type testMotorSetup struct {
+	deps           resource.Dependencies
+	expects, sends [][]byte
+}
+
+// withBoard gives the motor b as its board.
+func withBoard(b *inject.Board) testMotorOption {
+	return func(setup *testMotorSetup) {
+		setup.deps = resource.Dependencies{b.Name(): b}
+	}
+}
+
+// withSetupRx expects the transfers in expects, answered with sends, once setupTx is written, for
+// setups that read from the chip.
+func withSetupRx(expects, sends [][]byte) testMotorOption {
+	return func(setup *testMotorSetup) {
+		setup.expects, setup.sends = expects, sends
+	}
+}
+
+// makeTestMotor builds a motor on a fake SPI bus, expecting setupTx to be written during
+// construction.
+func makeTestMotor(t *testing.T, mc Config, setupTx [][]byte, opts ...testMotorOption) (*fakeSpiHandle, *Motor) {
+	t.Helper()
+	var setup testMotorSetup
+	for _, opt := range opts {
+		opt(&setup)
+	}
+	fakeSpiHandle, fakeSpi := newFakeSpi(t)
+	fakeSpiHandle.AddExpectedTx(setupTx)
+	if setup.expects != nil {
+		fakeSpiHandle.AddExpectedRx(setup.expects, setup.sends)
+	}
+
+	m, err := makeMotor(context.Background(), setup.deps, mc, resource.NewName(motor.API, "motor1"),
+		logging.NewTestLogger(t), fakeSpi)
+	test.That(t, err, test.ShouldBeNil)
+	t.Cleanup(func() {
+		fakeSpiHandle.ExpectDone()
+		test.That(t, m.Close(context.Background()), test.ShouldBeNil)
+	})
+	return fakeSpiHandle, m.(*Motor)
+}
+
+func TestWaitForMoveDuringGoTo(t *testing.T) {
+	ctx := context.Background()
+	fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+
+	fakeSpiHandle.AddExpectedTx([][]byte{
+		{160, 0, 0, 0, 0},
+		{164, 0, 0, 21, 8},   // a1
+		{166, 0, 0, 21, 8},   // aMax
+		{170, 0, 0, 21, 8},   // d1
+		{168, 0, 0, 21, 8},   // dMax
+		{163, 0, 0, 0, 1},    // vStart
+		{171, 0, 0, 0, 10},   // vStop
+		{165, 0, 2, 17, 149}, // v1
+		{167, 0, 0, 211, 213},
+		{173, 0, 2, 128, 0},
+	})
+	// Both GoTo and wait_for_move poll RAMP_STAT until the position is reached, and each reads the
+	// flag once when it is. Nothing else is written, so the move is never stopped.
+	const pending = 20
+	for i := 0; i < pending+2; i++ {
+		flags := byte(0)
+		if i >= pending {
+			flags = 2
+		}
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, flags, 0}},
+		)
+	}
+
+	moved := make(chan error, 1)
+	go func() {
+		moved <- m.GoTo(ctx, 50.0, 3.2, nil)
+	}()
+	// wait for the move to start polling before waiting on it
+	for fakeSpiHandle.transferred() < len(testMotorSetupTx)+12 {
+		time.Sleep(time.Millisecond)
+	}
+	test.That(t, m.waitForMove(ctx, time.Second), test.ShouldBeNil)
+	select {
+	case err := <-moved:
+		test.That(t, err, test.ShouldBeNil)
+	case <-time.After(time.Second):
+		t.Fatal("GoTo did not finish after wait_for_move")
+	}
+}
+
 func TestRPMBounds(t *testing.T) {
 	ctx := context.Background()
 	logger, obs := logging.NewObservedTestLogger(t)
@@ -125,6 +261,8 @@ func TestRPMBounds(t *testing.T) {
 		{177, 0, 0, 105, 234},
 		{167, 0, 0, 0, 0},
 		{160, 0, 0, 0, 1},
+		{1, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0},
 		{161, 0, 0, 0, 0},
 	})
 
@@ -212,6 +350,8 @@ func TestTMCStepperMotor(t *testing.T) {
 		{177, 0, 0, 105, 234},
 		{167, 0, 0, 0, 0},
 		{160, 0, 0, 0, 1},
+		{1, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0},
 		{161, 0, 0, 0, 0},
 	})
 
@@ -440,6 +580,129 @@ func TestTMCStepperMotor(t *testing.T) {
 		test.That(t, motorDep.GoTo(ctx, 50.0, 0, nil), test.ShouldBeNil)
 	})
 
+	t.Run("motor GoTo interrupted decelerates to a stop", func(t *testing.T) {
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+			{173, 0, 2, 128, 0},
+		})
+		// The position reached flag is checked once before the cancellation is noticed
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+			[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 0, 0}},
+		)
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			// Controlled stop: decelerate with dMax/d1
+			{166, 0, 0, 21, 8}, // aMax
+			{164, 0, 0, 21, 8}, // a1
+			{163, 0, 0, 0, 0},  // vStart
+			{167, 0, 0, 0, 0},  // vMax
+		})
+		// Wait for vzero, then read where the motor stopped
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 4, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 1, 44, 0},
+			},
+		)
+		// Hold at the stop position and restore the ramp parameters
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{173, 0, 1, 44, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+		})
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		err := motorDep.GoTo(cancelledCtx, 50.0, 3.2, nil)
+		test.That(t, err, test.ShouldNotBeNil)
+		test.That(t, err.Error(), test.ShouldContainSubstring, "stopped at 1.5000 revolutions")
+	})
+
+	t.Run("motor GoTo without waiting, then move_status and wait_for_move", func(t *testing.T) {
+		fakeSpiHandle.AddExpectedTx([][]byte{
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 0, 211, 213},
+			{173, 0, 2, 128, 0},
+		})
+		test.That(t, motorDep.GoTo(ctx, 50.0, 3.2, map[string]interface{}{"wait": false}), test.ShouldBeNil)
+
+		// Part way there at 1.0 revolutions
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0},
+			},
+		)
+		status, err := motorDep.DoCommand(ctx, map[string]interface{}{"command": "move_status"})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["target"], test.ShouldAlmostEqual, 3.2)
+		test.That(t, status["position"], test.ShouldAlmostEqual, 1.0)
+		test.That(t, status["remaining"], test.ShouldAlmostEqual, 2.2)
+		test.That(t, status["reached"], test.ShouldBeFalse)
+		test.That(t, status["stalled"], test.ShouldBeFalse)
+
+		// Position reached on the first poll, followed by the final status
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+				{53, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 2, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 2, 128, 0},
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 2, 0},
+			},
+		)
+		status, err = motorDep.DoCommand(ctx, map[string]interface{}{"command": "wait_for_move", "timeout_ms": 1000.0})
+		test.That(t, err, test.ShouldBeNil)
+		test.That(t, status["position"], test.ShouldAlmostEqual, 3.2)
+		test.That(t, status["remaining"], test.ShouldAlmostEqual, 0.0)
+		test.That(t, status["reached"], test.ShouldBeTrue)
+	})
+
 	t.Run("motor GoFor with positive rpm and positive revolutions", func(t *testing.T) {
 		// Check with position at 0.0 revolutions
 		//nolint:dupl
@@ -1018,6 +1281,8 @@ func TestTMCStepperMotor(t *testing.T) {
 			{177, 0, 0, 105, 234},
 			{167, 0, 0, 0, 0},
 			{160, 0, 0, 0, 1},
+			{1, 0, 0, 0, 0},
+			{1, 0, 0, 0, 0},
 			{161, 0, 0, 0, 0},
 		})
 
@@ -1049,6 +1314,8 @@ func TestTMCStepperMotor(t *testing.T) {
 			{177, 0, 0, 105, 234},
 			{167, 0, 0, 0, 0},
 			{160, 0, 0, 0, 1},
+			{1, 0, 0, 0, 0},
+			{1, 0, 0, 0, 0},
 			{161, 0, 0, 0, 0},
 		})
 
@@ -1082,6 +1349,8 @@ func TestTMCStepperMotor(t *testing.T) {
 			{177, 0, 0, 105, 234},
 			{167, 0, 0, 0, 0},
 			{160, 0, 0, 0, 1},
+			{1, 0, 0, 0, 0},
+			{1, 0, 0, 0, 0},
 			{161, 0, 0, 0, 0},
 		})
 
@@ -1248,3 +1517,160 @@ func TestRampParametersConfig(t *testing.T) {
 		test.That(t, *cfg.RampParameters.DMax, test.ShouldEqual, 1300)
 	})
 }
+
+func TestGearRatio(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.GearRatio = 2.5
+	// max_rpm, the acceleration and the derived ramp are all output shaft values, so the raw
+	// register values scale with the gear ratio.
+	fakeSpiHandle, m := makeTestMotor(t, mc, [][]byte{
+		{236, 0, 1, 0, 195},
+		{176, 0, 6, 15, 8},
+		{237, 0, 0, 0, 0},
+		{164, 0, 0, 52, 150},
+		{166, 0, 0, 52, 150},
+		{170, 0, 0, 52, 150},
+		{168, 0, 0, 52, 150},
+		{163, 0, 0, 0, 1},
+		{171, 0, 0, 0, 10},
+		{165, 0, 5, 43, 245},
+		{177, 0, 1, 8, 202},
+		{167, 0, 0, 0, 0},
+		{160, 0, 0, 0, 1},
+		{1, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0},
+		{161, 0, 0, 0, 0},
+	})
+	test.That(t, m.stepsPerRev, test.ShouldEqual, 128000)
+	test.That(t, m.rpmToV(50), test.ShouldAlmostEqual, 2.5*float64(rpmToV(50, maxRpm, baseClk, 51200)), 1)
+
+	// 4 motor revolutions are 1.6 output shaft revolutions
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{{33, 0, 0, 0, 0}, {33, 0, 0, 0, 0}},
+		[][]byte{{0, 0, 0, 0, 0}, {0, 0, 3, 32, 0}},
+	)
+	pos, err := m.Position(ctx, nil)
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, pos, test.ShouldAlmostEqual, 1.6)
+
+	mc.GearRatio = -1
+	_, _, err = mc.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+
+	// The default acceleration of a 50:1 gearbox is beyond the acceleration registers
+	mc.GearRatio = 50
+	mc.MaxRPM = 10
+	_, fakeSpi := newFakeSpi(t)
+	_, err = makeMotor(ctx, nil, mc, resource.NewName(motor.API, "motor1"), logging.NewTestLogger(t), fakeSpi)
+	test.That(t, err, test.ShouldNotBeNil)
+	test.That(t, err.Error(), test.ShouldContainSubstring, "max_acceleration_rpm_per_sec")
+	test.That(t, err.Error(), test.ShouldContainSubstring, "a1 must be between 0 and 65535")
+}
+
+// expectStallGuardApproach expects the motor to run in the given velocity mode at speed until
+// StallGuard stops it at the end stop, as in homing.
+func expectStallGuardApproach(fakeSpiHandle *fakeSpiHandle, mode byte, speed []byte) {
+	fakeSpiHandle.AddExpectedTx([][]byte{
+		{160, 0, 0, 0, mode},
+		append([]byte{167}, speed...),
+	})
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{
+			{53, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+			{180, 0, 0, 4, 0}, // sg_stop
+			{53, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+			{180, 0, 0, 0, 0},
+			{160, 0, 0, 0, 1},
+			{167, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+		},
+		[][]byte{
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 1, 0}, // velocity reached
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 4, 0}, // vzero
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 4, 0},
+		},
+	)
+}
+
+func TestHome(t *testing.T) {
+	ctx := context.Background()
+	mc := testMotorConfig()
+	mc.HomeBackoffRevs = 0.5
+	mc.HomeOffsetRevs = 0.25
+	// the back-off ends beyond the travel limits, which only apply once the motor is homed
+	maxPos := 0.25
+	mc.MaxPositionRevs = &maxPos
+	fakeSpiHandle, m := makeTestMotor(t, mc, testMotorSetupTx)
+
+	// Fast approach at home_rpm in the negative direction
+	expectStallGuardApproach(fakeSpiHandle, 2, []byte{0, 2, 17, 149})
+
+	// Back off 0.5 revolutions from the end stop
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{
+			{33, 0, 0, 0, 0},
+			{33, 0, 0, 0, 0},
+			{160, 0, 0, 0, 0},
+			{164, 0, 0, 21, 8},   // a1
+			{166, 0, 0, 21, 8},   // aMax
+			{170, 0, 0, 21, 8},   // d1
+			{168, 0, 0, 21, 8},   // dMax
+			{163, 0, 0, 0, 1},    // vStart
+			{171, 0, 0, 0, 10},   // vStop
+			{165, 0, 2, 17, 149}, // v1
+			{167, 0, 2, 17, 149},
+			{173, 0, 0, 100, 0},
+			{53, 0, 0, 0, 0},
+			{53, 0, 0, 0, 0},
+		},
+		[][]byte{
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 0, 0},
+			{0, 0, 0, 2, 0},
+		},
+	)
+
+	// Slow approach at a quarter of home_rpm
+	expectStallGuardApproach(fakeSpiHandle, 2, []byte{0, 0, 132, 101})
+
+	// Zeroed with the end stop at -home_offset_revs
+	fakeSpiHandle.AddExpectedRx(
+		[][]byte{{53, 0, 0, 0, 0}, {53, 0, 0, 0, 0}},
+		[][]byte{{0, 0, 0, 0, 0}, {0, 0, 0, 4, 0}},
+	)
+	fakeSpiHandle.AddExpectedTx([][]byte{
+		{160, 0, 0, 0, 3},
+		{173, 255, 255, 206, 0},
+		{161, 255, 255, 206, 0},
+	})
+	// GSTAT is checked so that only a later chip reset unhomes the motor
+	fakeSpiHandle.AddExpectedTx([][]byte{{1, 0, 0, 0, 0}, {1, 0, 0, 0, 0}})
+	_, err := m.DoCommand(ctx, map[string]interface{}{"command": "home"})
+	test.That(t, err, test.ShouldBeNil)
+
+	mc.HomeDirection = "up"
+	_, _, err = mc.Validate("")
+	test.That(t, err, test.ShouldNotBeNil)
+}
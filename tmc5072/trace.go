@@ -0,0 +1,166 @@
+//go:build linux
+
+// Package tmc5072 implements a TMC stepper motor. This file is for capturing traces of the
+// StallGuard reading and motor state over time.
+package tmc5072
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTraceInterval = 10 * time.Millisecond
+	defaultTraceSamples  = 6000
+)
+
+// traceSample is one sample of a trace.
+type traceSample struct {
+	t        time.Duration // since the trace started
+	sgResult int32
+	csActual int32
+	vActual  int32
+	position float64 // revolutions
+}
+
+// tracer holds the trace being captured or last captured.
+type tracer struct {
+	mu      sync.Mutex
+	cancel  context.CancelFunc
+	done    chan struct{}
+	samples []traceSample
+}
+
+// startTrace starts sampling SG_RESULT, CS_ACTUAL, VACTUAL and XACTUAL every interval in the
+// background, until stopTrace or maxSamples have been taken. It runs alongside whatever the
+// motor does next, such as homing. With sfilt the StallGuard filter is enabled for the duration.
+func (m *Motor) startTrace(ctx context.Context, interval time.Duration, maxSamples int, sfilt bool) error {
+	m.stopTrace()
+	if sfilt {
+		m.mu.Lock()
+		m.sgFilter = true
+		m.mu.Unlock()
+		if err := m.writeCoolConf(ctx); err != nil {
+			return err
+		}
+	}
+
+	traceCtx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	m.trace.mu.Lock()
+	m.trace.cancel, m.trace.done, m.trace.samples = cancel, done, nil
+	m.trace.mu.Unlock()
+
+	m.activeBackgroundWorkers.Add(1)
+	go func() {
+		defer m.activeBackgroundWorkers.Done()
+		defer close(done)
+		defer cancel()
+		if sfilt {
+			defer func() {
+				m.mu.Lock()
+				m.sgFilter = false
+				m.mu.Unlock()
+				if err := m.writeCoolConf(context.WithoutCancel(traceCtx)); err != nil {
+					m.logger.CError(traceCtx, err)
+				}
+			}()
+		}
+		m.runTrace(traceCtx, interval, maxSamples)
+	}()
+	return nil
+}
+
+// runTrace takes the samples of a trace.
+func (m *Motor) runTrace(ctx context.Context, interval time.Duration, maxSamples int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	for i := 0; i < maxSamples; i++ {
+		sample, err := m.traceSample(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				m.logger.CWarnf(ctx, "trace of motor (%s) stopped: %v", m.motorName, err)
+			}
+			return
+		}
+		sample.t = time.Since(start)
+		m.trace.mu.Lock()
+		m.trace.samples = append(m.trace.samples, sample)
+		m.trace.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// traceSample reads the registers making up one sample.
+func (m *Motor) traceSample(ctx context.Context) (traceSample, error) {
+	status, err := m.readReg(ctx, drvStatus)
+	if err != nil {
+		return traceSample{}, err
+	}
+	vel, err := m.getvActual(ctx)
+	if err != nil {
+		return traceSample{}, err
+	}
+	pos, err := m.readPosition(ctx)
+	if err != nil {
+		return traceSample{}, err
+	}
+	return traceSample{
+		sgResult: status & 1023,
+		csActual: (status >> 16) & 0x1F,
+		vActual:  vel,
+		position: m.loadPosition(pos),
+	}, nil
+}
+
+// stopTrace stops the trace being captured, if there is one, and waits for it to finish.
+func (m *Motor) stopTrace() {
+	m.trace.mu.Lock()
+	cancel, done := m.trace.cancel, m.trace.done
+	m.trace.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	cancel()
+	<-done
+}
+
+// traceResult returns the trace as a time series, one list per field, and whether it is still
+// being captured.
+func (m *Motor) traceResult() map[string]interface{} {
+	m.trace.mu.Lock()
+	defer m.trace.mu.Unlock()
+	running := false
+	if m.trace.done != nil {
+		select {
+		case <-m.trace.done:
+		default:
+			running = true
+		}
+	}
+	n := len(m.trace.samples)
+	t, sg, cs, v, pos := make([]interface{}, n), make([]interface{}, n), make([]interface{}, n),
+		make([]interface{}, n), make([]interface{}, n)
+	for i, sample := range m.trace.samples {
+		t[i] = sample.t.Seconds()
+		sg[i] = sample.sgResult
+		cs[i] = sample.csActual
+		v[i] = sample.vActual
+		pos[i] = sample.position
+	}
+	return map[string]interface{}{
+		"running":   running,
+		"t":         t,
+		"sg_result": sg,
+		"cs_actual": cs,
+		"v_actual":  v,
+		"position":  pos,
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package tmc5072
+
+import (
+	"context"
+	"testing"
+
+	"go.viam.com/test"
+)
+
+func TestTrace(t *testing.T) {
+	ctx := context.Background()
+	fakeSpiHandle, m := makeTestMotor(t, testMotorConfig(), testMotorSetupTx)
+
+	fakeSpiHandle.AddExpectedTx([][]byte{{237, 1, 0, 0, 0}}) // sfilt on
+	for i := 0; i < 2; i++ {
+		fakeSpiHandle.AddExpectedRx(
+			[][]byte{
+				{111, 0, 0, 0, 0},
+				{111, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{34, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+				{33, 0, 0, 0, 0},
+			},
+			[][]byte{
+				{0, 0, 0, 0, 0},
+				{0, 0, 12, 1, 44}, // CS_ACTUAL 12, SG_RESULT 300
+				{0, 0, 0, 0, 0},
+				{0, 0, 255, 255, 0}, // -256 in 24 bits
+				{0, 0, 0, 0, 0},
+				{0, 0, 0, 200, byte(i)},
+			},
+		)
+	}
+	fakeSpiHandle.AddExpectedTx([][]byte{{237, 0, 0, 0, 0}}) // sfilt off again
+
+	_, err := m.DoCommand(ctx, map[string]interface{}{
+		"command":     "start_trace",
+		"interval_ms": 1.0,
+		"max_samples": 2.0,
+		"sfilt":       true,
+	})
+	test.That(t, err, test.ShouldBeNil)
+	m.activeBackgroundWorkers.Wait()
+
+	resp, err := m.DoCommand(ctx, map[string]interface{}{"command": "get_trace"})
+	test.That(t, err, test.ShouldBeNil)
+	test.That(t, resp["running"], test.ShouldBeFalse)
+	test.That(t, resp["sg_result"], test.ShouldResemble, []interface{}{int32(300), int32(300)})
+	test.That(t, resp["cs_actual"], test.ShouldResemble, []interface{}{int32(12), int32(12)})
+	test.That(t, resp["v_actual"], test.ShouldResemble, []interface{}{int32(-256), int32(-256)})
+	test.That(t, resp["position"], test.ShouldResemble, []interface{}{1.0, 1.0 + 1.0/51200})
+	test.That(t, len(resp["t"].([]interface{})), test.ShouldEqual, 2)
+
+	_, err = m.DoCommand(ctx, map[string]interface{}{"command": "start_trace", "interval_ms": 0.0})
+	test.That(t, err, test.ShouldNotBeNil)
+}